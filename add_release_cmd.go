@@ -6,28 +6,81 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 	"time"
 )
 
 type AddReleaseCmd struct {
 	Release        string    `help:"Path to goreleaser dist folder." required:"" type:"existingdir"`
-	Notes          string    `help:"Notes about this release."`
+	Notes          string    `help:"Notes about this release." xor:"notes"`
+	NotesFile      string    `help:"Markdown file with notes about this release." type:"existingfile" xor:"notes"`
+	NotesTemplate  string    `help:"Go text/template file to render the notes from, with the metadata, notes and changelog available." type:"existingfile"`
+	NoChangelog    bool      `help:"Don't use the goreleaser changelog for notes when none are provided."`
 	Draft          bool      `help:"Is this release a draft?"`
 	Prerelease     bool      `help:"Is this a prelease?"`
 	IncludeBinary  bool      `help:"Include binary artifacts."`
 	Force          bool      `help:"Force add, removing existing if needed."`
 	PublishedAt    time.Time `help:"Specify exact time for release."`
 	PublishedAtNow bool      `help:"Use the current time for published at instead of the metadata date."`
+	ChecksumWarn   bool      `help:"Only warn when an artifact checksum doesn't match or uses an unsupported algorithm instead of failing."`
+	StrictSemver   bool      `help:"Fail instead of warning when the version isn't a valid semantic version."`
+	Channel        string    `help:"Release channel to add this release to, such as stable, beta or nightly."`
+	Dedupe         bool      `help:"Store artifacts in the content addressed blob store, hard linked into the release."`
+	Jobs           int       `help:"Number of artifacts to copy at once." default:"4" short:"j"`
+	LinkMode       string    `help:"How to place artifacts in the repo, falling back to copy when not possible. Auto tries reflink then hardlink." enum:"copy,hardlink,reflink,move,auto" default:"copy"`
+
+	ArtifactFilter `embed:""`
+}
+
+// Verify the options provided to the command.
+func (a *AddReleaseCmd) AfterApply() error {
+	if a.Jobs < 1 {
+		return errors.New("jobs must be at least 1")
+	}
+	return validateChannel(a.Channel)
 }
 
 // Adds a release to a repo.
 func (a *AddReleaseCmd) Run() error {
+	// Read metadata from goreleaser.
+	metadata, err := readMetadataFile(filepath.Join(a.Release, "metadata.json"))
+	if err != nil {
+		return err
+	}
+	versionPath := filepath.Join(app.flags.Repo, metadata.Version)
+
+	// If the version already exists, ask about replacing before locking the repo,
+	// so other processes aren't blocked waiting for an answer.
+	manifestFile := filepath.Join(app.flags.Repo, manifestFileName)
+	replace := a.Force
+	if current, merr := readManifestFile(manifestFile); !replace && merr == nil && current.FindRelease(metadata.Version) != -1 {
+		// If we don't want to replace, we should stop here.
+		if !askForConfirmation("This release already exists, should we replace?") {
+			return errors.New("version already exists")
+		}
+		replace = true
+	}
+
+	// Lock the repo so other processes don't modify it while we are.
+	lock, err := lockForWrite(false)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
 	// Read existing manifest for repo.
-	manifestFile := filepath.Join(app.flags.Repo, "manifest.yaml")
 	manifest, err := readManifestFile(manifestFile)
 	if os.IsNotExist(err) {
-		err = os.MkdirAll(app.flags.Repo, 0755)
+		// Don't start a new manifest over releases which are already in the repo.
+		orphans, oerr := findOrphans(app.flags.Repo, manifest)
+		if oerr != nil {
+			return oerr
+		}
+		if len(orphans) != 0 {
+			return errors.New("the repo has files but no manifest, use rebuild-manifest to recover it")
+		}
+		err = nil
 	}
 	if err != nil {
 		return err
@@ -38,12 +91,13 @@ func (a *AddReleaseCmd) Run() error {
 		manifest.Releases[i].ID = release.ReleaseID
 	}
 
-	// Read metadata from goreleaser.
-	metadata, err := readMetadataFile(filepath.Join(a.Release, "metadata.json"))
-	if err != nil {
-		return err
+	// Releases are ordered by semantic version, so warn if it isn't one.
+	if _, verr := parseVersion(metadata.Version); verr != nil {
+		if a.StrictSemver {
+			return verr
+		}
+		log.Println("Warning:", verr)
 	}
-	versionPath := filepath.Join(app.flags.Repo, metadata.Version)
 
 	// Read the artifcats to ensure we have a valid release.
 	artifacts, err := readArtifactFile(filepath.Join(a.Release, "artifacts.json"))
@@ -69,31 +123,59 @@ func (a *AddReleaseCmd) Run() error {
 		}
 	}
 
-	// Check if the version already exists.
-	existingIndex := -1
-	for i, release := range manifest.Releases {
-		if release.TagName == metadata.Version {
-			existingIndex = i
+	// Determine the release notes.
+	notes, err := a.releaseNotes(metadata)
+	if err != nil {
+		return err
+	}
+
+	// Read the checksums file goreleaser made, if there is one.
+	var checksums map[string]string
+	checksumAlgorithm := defaultChecksumAlgorithm
+	config, err := readConfigFile(filepath.Join(a.Release, "config.yaml"))
+	if err == nil && config.Checksum.Algorithm != "" {
+		checksumAlgorithm = config.Checksum.Algorithm
+	}
+	for _, artifact := range artifacts {
+		if artifact.Type == "Checksum" {
+			checksums, err = readChecksumsFile(filepath.Join(artifcatBase, artifact.Path))
+			if err != nil && !os.IsNotExist(err) {
+				return fmt.Errorf("Error reading checksums file: %s", err)
+			}
 			break
 		}
 	}
 
-	// If the version already exists, ask about replacing.
-	if existingIndex != -1 {
-		if !a.Force {
-			ans := askForConfirmation("This release already exists, should we replace?")
+	// Check if the version already exists.
+	existingIndex := manifest.FindRelease(metadata.Version)
 
-			// If we don't want to replace, we should stop here.
-			if !ans {
-				return errors.New("version already exists")
-			}
-		}
+	// The version may have been added while we waited for the lock.
+	if existingIndex != -1 && !replace {
+		return errors.New("version already exists")
+	}
 
-		// We need to replace the release, so remove it.
-		manifest.Releases = append(manifest.Releases[:existingIndex], manifest.Releases[existingIndex+1:]...)
+	// Keep the current manifest state so we can restore it if anything fails.
+	previous := *manifest
+	previous.Releases = slices.Clone(manifest.Releases)
 
-		// Remove the version directory.
-		os.RemoveAll(versionPath)
+	// Stage the release in the repo so it can be renamed into place once complete.
+	stagingPath, err := os.MkdirTemp(app.flags.Repo, ".staging-"+metadata.Version+"-")
+	if err != nil {
+		return fmt.Errorf("Error making staging directory: %s", err)
+	}
+	defer os.RemoveAll(stagingPath)
+
+	// Temp directories are private, but the release must be readable by the web server.
+	err = os.Chmod(stagingPath, 0755)
+	if err != nil {
+		return fmt.Errorf("Error making staging directory: %s", err)
+	}
+
+	// If replacing, remove the existing release from the manifest, keeping its pin.
+	pinned := false
+	if existingIndex != -1 {
+		pinned = manifest.Releases[existingIndex].Pinned
+		manifest.Releases = slices.Delete(manifest.Releases, existingIndex, existingIndex+1)
 	}
 
 	// Make the release.
@@ -107,7 +189,12 @@ func (a *AddReleaseCmd) Run() error {
 		Draft:        a.Draft,
 		Prerelease:   a.Prerelease,
 		PublishedAt:  metadata.Date,
-		ReleaseNotes: a.Notes,
+		ReleaseNotes: notes,
+		Tag:          metadata.Tag,
+		PreviousTag:  metadata.PreviousTag,
+		Commit:       metadata.Commit,
+		Channel:      a.Channel,
+		Pinned:       pinned,
 	}
 
 	// If the publish date provided is valid, override.
@@ -120,16 +207,23 @@ func (a *AddReleaseCmd) Run() error {
 		release.PublishedAt = app.now
 	}
 
-	// Make the directory for the release.
-	err = os.Mkdir(versionPath, 0755)
-	if err != nil && !os.IsExist(err) {
-		return fmt.Errorf("Error making release directory: %s", err)
+	// Preserve the goreleaser metadata so releases can be traced to their source.
+	// This is always copied, as moving artifacts may remove the metadata file from dist.
+	metadataPath := filepath.Join(stagingPath, releaseMetadataDir)
+	err = os.Mkdir(metadataPath, 0755)
+	if err == nil {
+		err = copyFile(filepath.Join(a.Release, "metadata.json"), filepath.Join(metadataPath, "metadata.json"))
+	}
+	if err != nil {
+		return fmt.Errorf("Error preserving goreleaser metadata: %s", err)
 	}
 
-	// Add artifacts.
+	// Plan the artifacts to copy.
+	var copies []*ArtifactCopy
+	var totalSize int64
 	for _, artifact := range artifacts {
-		// Skip binaries if not included.
-		if artifact.Type == "Binary" && !a.IncludeBinary {
+		// Skip artifacts the filters don't include.
+		if !a.ArtifactFilter.Match(artifact, a.IncludeBinary) {
 			continue
 		}
 
@@ -148,46 +242,286 @@ func (a *AddReleaseCmd) Run() error {
 		// Determine if artifact is in its own sub dir, make sure it exists.
 		dir := filepath.Dir(relativePath)
 		if dir != "." {
-			os.MkdirAll(filepath.Join(versionPath, dir), 0755)
+			err = os.MkdirAll(filepath.Join(stagingPath, dir), 0755)
+			if err != nil {
+				return fmt.Errorf("Error making artifact directory: %s", err)
+			}
 		}
 
-		// Copy artifact to repo.
-		err = copyFile(path, filepath.Join(versionPath, relativePath))
+		// Determine the checksums expected for this artifact.
+		var expected []*Checksum
+		if artifact.Extra.Checksum != "" {
+			checksum, cerr := parseArtifactChecksum(artifact.Extra.Checksum)
+			if cerr != nil {
+				return cerr
+			}
+			expected = append(expected, checksum)
+		}
+		if sum, ok := checksums[artifact.Name]; ok {
+			expected = append(expected, &Checksum{
+				Algorithm: checksumAlgorithm,
+				Sum:       sum,
+				Source:    "checksums file",
+			})
+		}
+		// Checksums with algorithms we can't verify are skipped if only warning.
+		if a.ChecksumWarn {
+			expected = slices.DeleteFunc(expected, func(checksum *Checksum) bool {
+				if _, herr := newChecksumHash(checksum.Algorithm); herr != nil {
+					log.Printf("Skipping %s checksum of artifact %s: %s", checksum.Source, artifact.Name, herr)
+					return true
+				}
+				return false
+			})
+		}
+		verifier, err := newChecksumVerifier(expected)
 		if err != nil {
-			log.Printf("Failed to copy artifact, skipping it: %s", err)
-			continue
+			return err
 		}
 
+		copies = append(copies, &ArtifactCopy{
+			Artifact:     artifact,
+			Source:       path,
+			RelativePath: relativePath,
+			Size:         stat.Size(),
+			Verifier:     verifier,
+		})
+		totalSize += stat.Size()
+	}
+
+	// Copy the artifacts to the staged release.
+	progress := newProgress(len(copies), totalSize)
+	progress.Start()
+	err = runJobs(len(copies), a.Jobs, func(i int) error {
+		return a.copyArtifact(copies[i], stagingPath, progress)
+	})
+	progress.Stop()
+	if err != nil {
+		return err
+	}
+
+	// Add artifacts, keeping the goreleaser entries for the ones published.
+	var published []map[string]any
+	for _, c := range copies {
 		// Make asset.
 		manifest.LastAssetID++
 		asset := &HttpAsset{
-			ID:   manifest.LastAssetID,
-			Name: artifact.Name,
-			Size: int(stat.Size()),
-			URL:  filepath.Join(metadata.Version, relativePath),
+			ID:       manifest.LastAssetID,
+			Name:     c.Artifact.Name,
+			Size:     int(c.Size),
+			URL:      filepath.Join(metadata.Version, c.RelativePath),
+			Type:     c.Artifact.Type,
+			Goos:     c.Artifact.Goos,
+			Goarch:   c.Artifact.Goarch,
+			Goarm:    c.Artifact.Goarm,
+			Goamd64:  c.Artifact.Goamd64,
+			Checksum: c.Verifier.Checksum(),
 		}
 
 		// Add to the release.
 		release.Assets = append(release.Assets, asset)
+
+		// Keep the goreleaser entry with its path in the release.
+		entry, err := c.Artifact.WithPath(filepath.ToSlash(c.RelativePath))
+		if err != nil {
+			return err
+		}
+		published = append(published, entry)
 	}
 
-	// Add release to manifest.
+	// Preserve the goreleaser artifacts published with the release.
+	err = writeArtifactFile(filepath.Join(metadataPath, "artifacts.json"), published)
+	if err != nil {
+		return fmt.Errorf("Error preserving goreleaser metadata: %s", err)
+	}
+
+	// Sign assets goreleaser didn't sign, if we have a signing key.
+	if app.signer != nil {
+		// Find which assets already have signatures.
+		signed := make(map[string]bool)
+		for _, asset := range release.Assets {
+			if strings.HasSuffix(asset.Name, signatureSuffix) {
+				signed[strings.TrimSuffix(asset.Name, signatureSuffix)] = true
+			}
+		}
+
+		// Sign the rest.
+		for _, asset := range release.Assets {
+			if signed[asset.Name] || asset.Type == "Signature" || asset.Type == "Certificate" {
+				continue
+			}
+			relativePath, _ := filepath.Rel(metadata.Version, asset.URL)
+			path := filepath.Join(stagingPath, relativePath)
+			err = signFile(app.signer, path)
+			if err != nil {
+				return fmt.Errorf("Failed to sign artifact %s: %s", asset.Name, err)
+			}
+			stat, serr := os.Stat(path + signatureSuffix)
+			if serr != nil {
+				return serr
+			}
+
+			// Add the signature as an asset so clients can find it.
+			manifest.LastAssetID++
+			release.Assets = append(release.Assets, &HttpAsset{
+				ID:   manifest.LastAssetID,
+				Name: asset.Name + signatureSuffix,
+				Size: int(stat.Size()),
+				URL:  asset.URL + signatureSuffix,
+				Type: "Signature",
+			})
+		}
+	}
+
+	// Add release to manifest, keeping it in version order.
 	manifest.Releases = append(manifest.Releases, release)
+	manifest.Sort()
+
+	// Move any existing version directory aside so it can be restored on failure.
+	backupPath := stagingPath + ".old"
+	_, serr := os.Lstat(versionPath)
+	hasBackup := serr == nil
+	if hasBackup {
+		err = os.Rename(versionPath, backupPath)
+		if err != nil {
+			return fmt.Errorf("Error moving existing release aside: %s", err)
+		}
+	}
+
+	// Restore the repo to the state before we started.
+	rollback := func() {
+		os.RemoveAll(versionPath)
+		if hasBackup {
+			if rerr := os.Rename(backupPath, versionPath); rerr != nil {
+				log.Println("Failed to restore previous release directory, it is available at", backupPath)
+			}
+		}
+	}
+
+	// Swap the staged release into place.
+	err = os.Rename(stagingPath, versionPath)
+	if err != nil {
+		rollback()
+		return fmt.Errorf("Error moving staged release into place: %s", err)
+	}
 
 	// Write the manifest.
 	err = writeManifestFile(manifestFile, manifest)
 	if err != nil {
+		rollback()
 		return err
 	}
 
-	// If not a draft or prerelease, link latest to this release.
-	if !a.Draft && !a.Prerelease {
-		latestPath := filepath.Join(app.flags.Repo, "latest")
-		os.Remove(latestPath)
-		os.Symlink(metadata.Version, latestPath)
+	// Link latest to the highest stable release, which may be this one, and update the channels.
+	err = updateLatestLinks(app.flags.Repo, manifest)
+	if err != nil {
+		rollback()
+		if merr := writeManifestFile(manifestFile, &previous); merr != nil {
+			log.Println("Failed to restore previous manifest:", merr)
+		}
+		updateLatestLinks(app.flags.Repo, &previous)
+		return fmt.Errorf("Error linking latest release: %s", err)
+	}
+
+	// The release is in place, so the old release is no longer needed.
+	if hasBackup {
+		os.RemoveAll(backupPath)
+	}
+
+	// Now the release is committed, finish moving the artifacts by removing them from dist.
+	if a.LinkMode == "move" {
+		for _, c := range copies {
+			if rerr := os.Remove(c.Source); rerr != nil {
+				log.Println("Failed to remove moved artifact:", rerr)
+			}
+		}
 	}
 
 	log.Println("Added release", metadata.Version, "for", metadata.Name, "to the repo", app.flags.Repo)
 
 	return nil
 }
+
+// An artifact to copy into the staged release.
+type ArtifactCopy struct {
+	Artifact     *Artifact
+	Source       string
+	RelativePath string
+	Size         int64
+	Verifier     *ChecksumVerifier
+}
+
+// Copy an artifact into the staged release and verify it.
+func (a *AddReleaseCmd) copyArtifact(c *ArtifactCopy, stagingPath string, progress *Progress) error {
+	// Place artifact in the staged release.
+	dstPath := filepath.Join(stagingPath, c.RelativePath)
+	err := placeFile(c.Source, dstPath, a.LinkMode, append(c.Verifier.Writers(), progress)...)
+	if err != nil {
+		return fmt.Errorf("Failed to copy artifact %s: %s", c.Artifact.Name, err)
+	}
+	progress.Done()
+
+	// Confirm the copied data matches what goreleaser built.
+	err = c.Verifier.Verify()
+	if err != nil {
+		if !a.ChecksumWarn {
+			return fmt.Errorf("Artifact %s failed verification: %s", c.Artifact.Name, err)
+		}
+		log.Printf("Artifact %s failed verification: %s", c.Artifact.Name, err)
+	}
+
+	// Move the artifact into the blob store if deduplicating.
+	if a.Dedupe {
+		err = storeBlob(app.flags.Repo, dstPath, c.Verifier.Checksum())
+		if err != nil {
+			return fmt.Errorf("Failed to store artifact %s: %s", c.Artifact.Name, err)
+		}
+	}
+	return nil
+}
+
+// Determine the release notes from the options provided.
+func (a *AddReleaseCmd) releaseNotes(metadata *Metadata) (string, error) {
+	data := &NotesData{
+		ProjectName: metadata.Name,
+		Version:     metadata.Version,
+		Tag:         metadata.Tag,
+		PreviousTag: metadata.PreviousTag,
+		Commit:      metadata.Commit,
+		Date:        metadata.Date,
+		Notes:       a.Notes,
+	}
+
+	// Read the notes file if provided.
+	if a.NotesFile != "" {
+		notes, err := readNotesFile(a.NotesFile)
+		if err != nil {
+			return "", fmt.Errorf("Error reading notes file: %s", err)
+		}
+		data.Notes = notes
+	}
+
+	// Read the changelog goreleaser generated, if there is one.
+	if !a.NoChangelog {
+		changelog, err := readNotesFile(filepath.Join(a.Release, changelogFileName))
+		if err != nil && !os.IsNotExist(err) {
+			return "", fmt.Errorf("Error reading changelog: %s", err)
+		}
+		data.Changelog = changelog
+	}
+
+	// A template decides how to use the notes and changelog.
+	if a.NotesTemplate != "" {
+		notes, err := renderNotesTemplate(a.NotesTemplate, data)
+		if err != nil {
+			return "", fmt.Errorf("Error rendering notes template: %s", err)
+		}
+		return notes, nil
+	}
+
+	// Otherwise notes provided are used over the changelog.
+	if data.Notes != "" {
+		return data.Notes, nil
+	}
+	return data.Changelog, nil
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// The directory in the repo content addressed artifacts are stored in.
+const blobsDirName = "blobs"
+
+// The path to the blob for a checksum in the `algorithm:sum` form.
+func blobPath(repo, checksum string) (string, error) {
+	algorithm, sum, ok := strings.Cut(checksum, ":")
+	if !ok || len(sum) < 3 {
+		return "", fmt.Errorf("invalid checksum for blob: %s", checksum)
+	}
+	return filepath.Join(repo, blobsDirName, algorithm, sum[:2], sum), nil
+}
+
+// Store a file in the blob store, replacing the file with a hard link to the blob.
+// If the blob already exists, the file is replaced with a link to the existing blob.
+// New blobs are copied, as the file may be linked to one outside the repo, such as in dist.
+func storeBlob(repo, path, checksum string) error {
+	blob, err := blobPath(repo, checksum)
+	if err != nil {
+		return err
+	}
+
+	// If we already have this blob, link to it instead.
+	if stat, serr := os.Stat(blob); serr == nil {
+		fstat, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		if stat.Size() == fstat.Size() {
+			tmpPath := path + ".blob"
+			err = os.Link(blob, tmpPath)
+			if err != nil {
+				return err
+			}
+			return os.Rename(tmpPath, path)
+		}
+		log.Println("Replacing blob with a size mismatch:", blob)
+		os.Remove(blob)
+	}
+
+	// Copy the file to a new blob. Blobs are shared, so they are made read only.
+	err = os.MkdirAll(filepath.Dir(blob), 0755)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(blob), ".blob-*")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+	tmp.Close()
+	os.Remove(tmpPath)
+	err = placeFile(path, tmpPath, "reflink")
+	if err == nil {
+		err = os.Chmod(tmpPath, 0444)
+	}
+	if err == nil {
+		err = os.Link(tmpPath, blob)
+	}
+	os.Remove(tmpPath)
+
+	// Another copy may have added the same blob at the same time, either way link to it.
+	if err != nil && !os.IsExist(err) {
+		return err
+	}
+	return storeBlob(repo, path, checksum)
+}
+
+// Remove blobs no longer referenced by any asset, returning the number removed and bytes reclaimed.
+func collectBlobs(repo string, manifest *HttpManifest, dryRun bool) (int, int64, error) {
+	// Without a blob store, there's nothing to collect.
+	blobsDir := filepath.Join(repo, blobsDirName)
+	if _, err := os.Stat(blobsDir); os.IsNotExist(err) {
+		return 0, 0, nil
+	}
+
+	// Trashed releases still reference their blobs until the trash is emptied.
+	releases := slices.Clone(manifest.Releases)
+	trash, err := readTrash(repo)
+	if err != nil {
+		return 0, 0, err
+	}
+	for _, entry := range trash {
+		releases = append(releases, entry.Manifest.Releases...)
+	}
+
+	// Count the references to each blob.
+	references := make(map[string]int)
+	for _, release := range releases {
+		for _, asset := range release.Assets {
+			if asset.Checksum == "" {
+				continue
+			}
+			blob, err := blobPath(repo, asset.Checksum)
+			if err == nil {
+				references[blob]++
+			}
+		}
+	}
+
+	// Remove the blobs without references.
+	removed := 0
+	var reclaimed int64
+	err = filepath.WalkDir(blobsDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		if references[path] != 0 {
+			return nil
+		}
+		stat, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if dryRun {
+			log.Println("Would remove unreferenced blob:", filepath.Base(path))
+		} else {
+			log.Println("Removing unreferenced blob:", filepath.Base(path))
+			err = os.Remove(path)
+			if err != nil {
+				return err
+			}
+		}
+		removed++
+		reclaimed += stat.Size()
+		return nil
+	})
+	return removed, reclaimed, err
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"bufio"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+// The checksum algorithm goreleaser uses when none is configured.
+const defaultChecksumAlgorithm = "sha256"
+
+// Make a new hash for a goreleaser checksum algorithm.
+func newChecksumHash(algorithm string) (hash.Hash, error) {
+	switch strings.ToLower(algorithm) {
+	case "sha256":
+		return sha256.New(), nil
+	case "sha224":
+		return sha256.New224(), nil
+	case "sha512":
+		return sha512.New(), nil
+	case "sha384":
+		return sha512.New384(), nil
+	case "sha1":
+		return sha1.New(), nil
+	case "md5":
+		return md5.New(), nil
+	case "blake2b":
+		return blake2b.New512(nil)
+	}
+	return nil, fmt.Errorf("unsupported checksum algorithm: %s", algorithm)
+}
+
+// A checksum expected for an artifact.
+type Checksum struct {
+	Algorithm string
+	Sum       string
+	Source    string
+}
+
+// Parse a goreleaser artifact checksum in the form of `algorithm:sum`.
+func parseArtifactChecksum(checksum string) (*Checksum, error) {
+	algorithm, sum, ok := strings.Cut(checksum, ":")
+	if !ok || algorithm == "" || sum == "" {
+		return nil, fmt.Errorf("invalid artifact checksum: %s", checksum)
+	}
+	return &Checksum{
+		Algorithm: strings.ToLower(algorithm),
+		Sum:       strings.ToLower(sum),
+		Source:    "artifacts.json",
+	}, nil
+}
+
+// Read and parse a checksums file into a map of file name to checksum.
+func readChecksumsFile(checksumsFile string) (map[string]string, error) {
+	// Read file, if error return the error.
+	f, err := os.Open(checksumsFile)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	// Each line is the sum followed by the file name.
+	sums := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			continue
+		}
+
+		// A leading asterisk marks binary mode in sum tools.
+		name := strings.TrimPrefix(fields[1], "*")
+		sums[name] = strings.ToLower(fields[0])
+	}
+
+	// Return the sums and if any error occurred.
+	return sums, scanner.Err()
+}
+
+// Hashes a file is run through while copying, used to verify expected checksums.
+type ChecksumVerifier struct {
+	expected []*Checksum
+	hashes   map[string]hash.Hash
+}
+
+// Make a verifier for the expected checksums of a file.
+// The default algorithm is always hashed so the file checksum can be recorded.
+func newChecksumVerifier(expected []*Checksum) (*ChecksumVerifier, error) {
+	v := &ChecksumVerifier{
+		expected: expected,
+		hashes:   make(map[string]hash.Hash),
+	}
+	v.hashes[defaultChecksumAlgorithm] = sha256.New()
+
+	// Make one hash per algorithm needed.
+	for _, checksum := range expected {
+		if _, ok := v.hashes[checksum.Algorithm]; ok {
+			continue
+		}
+		h, err := newChecksumHash(checksum.Algorithm)
+		if err != nil {
+			return nil, err
+		}
+		v.hashes[checksum.Algorithm] = h
+	}
+	return v, nil
+}
+
+// The hashes to write the file data to.
+func (v *ChecksumVerifier) Writers() []io.Writer {
+	var writers []io.Writer
+	for _, h := range v.hashes {
+		writers = append(writers, h)
+	}
+	return writers
+}
+
+// Confirm the data written matches every expected checksum.
+func (v *ChecksumVerifier) Verify() error {
+	for _, checksum := range v.expected {
+		sum := hex.EncodeToString(v.hashes[checksum.Algorithm].Sum(nil))
+		if sum != checksum.Sum {
+			return fmt.Errorf("%s checksum from %s does not match, expected %s got %s", checksum.Algorithm, checksum.Source, checksum.Sum, sum)
+		}
+	}
+	return nil
+}
+
+// The checksum of the data written in the `algorithm:sum` form goreleaser uses.
+func (v *ChecksumVerifier) Checksum() string {
+	return defaultChecksumAlgorithm + ":" + hex.EncodeToString(v.hashes[defaultChecksumAlgorithm].Sum(nil))
+}
+
+// Confirm a file matches a checksum in the `algorithm:sum` form.
+func verifyFileChecksum(path, checksum string) error {
+	expected, err := parseArtifactChecksum(checksum)
+	if err != nil {
+		return err
+	}
+	expected.Source = "manifest"
+	verifier, err := newChecksumVerifier([]*Checksum{expected})
+	if err != nil {
+		return err
+	}
+
+	// Hash the file.
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	for _, h := range verifier.Writers() {
+		if _, err = f.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		if _, err = io.Copy(h, f); err != nil {
+			return err
+		}
+	}
+
+	return verifier.Verify()
+}
+
+// Compute the checksum of a file in the `algorithm:sum` form with the default algorithm.
+func fileChecksum(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err = io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return defaultChecksumAlgorithm + ":" + hex.EncodeToString(h.Sum(nil)), nil
+}
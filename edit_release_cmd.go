@@ -0,0 +1,84 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+type EditReleaseCmd struct {
+	Tag            string     `help:"Tag of the release to edit." required:""`
+	Name           *string    `help:"Name of the release."`
+	Notes          *string    `help:"Notes about this release." xor:"notes"`
+	NotesFile      string     `help:"Markdown file with notes about this release." type:"existingfile" xor:"notes"`
+	PublishedAt    *time.Time `help:"Specify exact time for release." xor:"published"`
+	PublishedAtNow bool       `help:"Use the current time for published at." xor:"published"`
+	Draft          *bool      `help:"Is this release a draft?" negatable:""`
+	Prerelease     *bool      `help:"Is this a prelease?" negatable:""`
+	Channel        *string    `help:"Release channel, empty to remove the release from its channel."`
+}
+
+// Verify the options provided to the command.
+func (a *EditReleaseCmd) AfterApply() error {
+	if a.Channel != nil {
+		return validateChannel(*a.Channel)
+	}
+	return nil
+}
+
+// Edits the metadata of a release in a repo.
+func (a *EditReleaseCmd) Run() error {
+	err := modifyRelease(a.Tag, a.edit)
+	if err != nil {
+		return err
+	}
+
+	log.Println("Updated release", a.Tag, "in the repo", app.flags.Repo)
+
+	return nil
+}
+
+// Apply the changes requested to the release.
+func (a *EditReleaseCmd) edit(release *HttpRelease) (err error) {
+	changed := false
+	if a.Name != nil {
+		release.Name = *a.Name
+		changed = true
+	}
+	if a.Notes != nil {
+		release.ReleaseNotes = *a.Notes
+		changed = true
+	}
+	if a.NotesFile != "" {
+		release.ReleaseNotes, err = readNotesFile(a.NotesFile)
+		if err != nil {
+			return fmt.Errorf("unable to read notes file: %s", err)
+		}
+		changed = true
+	}
+	if a.PublishedAt != nil {
+		release.PublishedAt = *a.PublishedAt
+		changed = true
+	}
+	if a.PublishedAtNow {
+		release.PublishedAt = app.now
+		changed = true
+	}
+	if a.Draft != nil {
+		release.Draft = *a.Draft
+		changed = true
+	}
+	if a.Prerelease != nil {
+		release.Prerelease = *a.Prerelease
+		changed = true
+	}
+	if a.Channel != nil {
+		release.Channel = *a.Channel
+		changed = true
+	}
+	if !changed {
+		return errors.New("no changes provided")
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+type EmptyTrashCmd struct {
+	OlderThan time.Duration `help:"Only remove releases trashed longer ago than this."`
+	DryRun    bool          `help:"Just log the result without actually removing."`
+}
+
+// Permanently removes releases from the trash.
+func (a *EmptyTrashCmd) Run() error {
+	// Lock the repo so other processes don't modify it while we are.
+	lock, err := lockRepo(app.flags.Repo)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
+	// Remove the entries old enough.
+	trash, err := readTrash(app.flags.Repo)
+	if err != nil {
+		return err
+	}
+	entriesRemoved := 0
+	var reclaimed int64
+	for _, entry := range trash {
+		if app.now.Sub(entry.Time) < a.OlderThan {
+			continue
+		}
+		for _, release := range entry.Manifest.Releases {
+			log.Println("Removing trashed release:", release.TagName)
+		}
+		if !a.DryRun {
+			err = os.RemoveAll(entry.Path)
+			if err != nil {
+				return fmt.Errorf("unable to remove trash entry: %s", err)
+			}
+		}
+		entriesRemoved++
+		reclaimed += entry.Size()
+	}
+	log.Println("Removed", entriesRemoved, "trash entries, reclaiming up to", formatSize(reclaimed))
+
+	// Blobs can't be collected until the entries are actually removed.
+	if a.DryRun {
+		return nil
+	}
+
+	// Remove blobs the trashed releases were the last reference to.
+	manifest, err := readManifestFile(filepath.Join(app.flags.Repo, manifestFileName))
+	if err != nil {
+		return err
+	}
+	blobsRemoved, blobsReclaimed, err := collectBlobs(app.flags.Repo, manifest, false)
+	if err != nil {
+		return fmt.Errorf("unable to collect unreferenced blobs: %s", err)
+	}
+	if blobsRemoved != 0 {
+		log.Println("Removed", blobsRemoved, "unreferenced blobs, reclaiming", formatSize(blobsReclaimed))
+	}
+
+	return nil
+}
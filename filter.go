@@ -0,0 +1,67 @@
+package main
+
+import (
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Rules for which artifacts to publish.
+type ArtifactFilter struct {
+	IncludeType []string `help:"Only include artifacts of these types, such as Archive, Binary, Checksum, Signature, Certificate, SBOM, \"Linux Package\" or \"Source Archive\"."`
+	ExcludeType []string `help:"Exclude artifacts of these types."`
+	Goos        []string `help:"Only include artifacts for these operating systems, artifacts without one are kept."`
+	Goarch      []string `help:"Only include artifacts for these architectures, artifacts without one are kept."`
+	ID          []string `help:"Only include artifacts from these goreleaser build or archive IDs, artifacts without one are kept."`
+	Include     []string `help:"Only include artifacts with file names matching these globs."`
+	Exclude     []string `help:"Exclude artifacts with file names matching these globs."`
+}
+
+// Helper to check if a list contains a value, ignoring case.
+func containsFold(list []string, value string) bool {
+	return slices.ContainsFunc(list, func(s string) bool {
+		return strings.EqualFold(s, value)
+	})
+}
+
+// Helper to check if a name matches any of the globs.
+func matchAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := filepath.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Check if an artifact should be published.
+// Binaries are only published if asked for, as archives are normally used for updates.
+func (f *ArtifactFilter) Match(artifact *Artifact, includeBinary bool) bool {
+	// Filter by type.
+	if artifact.Type == "Binary" && !includeBinary && !containsFold(f.IncludeType, artifact.Type) {
+		return false
+	}
+	if len(f.IncludeType) != 0 && !containsFold(f.IncludeType, artifact.Type) {
+		return false
+	}
+	if containsFold(f.ExcludeType, artifact.Type) {
+		return false
+	}
+
+	// Filter by platform and ID, where the artifact has one.
+	if len(f.Goos) != 0 && artifact.Goos != "" && !containsFold(f.Goos, artifact.Goos) {
+		return false
+	}
+	if len(f.Goarch) != 0 && artifact.Goarch != "" && !containsFold(f.Goarch, artifact.Goarch) {
+		return false
+	}
+	if len(f.ID) != 0 && artifact.Extra.ID != "" && !slices.Contains(f.ID, artifact.Extra.ID) {
+		return false
+	}
+
+	// Filter by file name.
+	if len(f.Include) != 0 && !matchAny(f.Include, artifact.Name) {
+		return false
+	}
+	return !matchAny(f.Exclude, artifact.Name)
+}
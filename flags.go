@@ -1,7 +1,9 @@
 package main
 
 import (
+	"errors"
 	"fmt"
+
 	"github.com/alecthomas/kong"
 )
 
@@ -17,10 +19,44 @@ func (v VersionFlag) BeforeApply(app *kong.Kong, vars kong.Vars) error {
 
 // Flags supplied to cli.
 type Flags struct {
-	Version    VersionFlag   `name:"version" help:"Print version information and quit"`
-	Repo       string        `help:"The path to a repo" required:"" type:"existingdir"`
-	AddRelease AddReleaseCmd `cmd:"" help:"Add an release to the repo"`
-	Prune      PruneCmd      `cmd:"" help:"Prune releases from repo."`
+	Version         VersionFlag        `name:"version" help:"Print version information and quit"`
+	Repo            string             `help:"The path to a repo, required by all commands except keygen." type:"existingdir"`
+	SigningKey      string             `help:"Private key to sign the manifest and new assets with." type:"existingfile"`
+	AddRelease      AddReleaseCmd      `cmd:"" help:"Add an release to the repo"`
+	Prune           PruneCmd           `cmd:"" help:"Prune releases from repo."`
+	RemoveRelease   RemoveReleaseCmd   `cmd:"" help:"Remove a release from the repo."`
+	Restore         RestoreCmd         `cmd:"" help:"Restore a removed release from the trash."`
+	EmptyTrash      EmptyTrashCmd      `cmd:"" help:"Permanently remove releases from the trash."`
+	EditRelease     EditReleaseCmd     `cmd:"" help:"Edit the metadata of a release."`
+	Promote         PromoteCmd         `cmd:"" help:"Promote a draft or prerelease to a published release."`
+	Demote          DemoteCmd          `cmd:"" help:"Demote a published release to a draft or prerelease."`
+	Pin             PinCmd             `cmd:"" help:"Pin a release so prune never removes it."`
+	Unpin           UnpinCmd           `cmd:"" help:"Unpin a release so prune may remove it."`
+	List            ListCmd            `cmd:"" help:"List releases in the repo."`
+	Show            ShowCmd            `cmd:"" help:"Show the details of a release."`
+	RebuildManifest RebuildManifestCmd `cmd:"" help:"Rebuild the manifest from the release directories in the repo."`
+	Gc              GcCmd              `cmd:"" help:"List or delete files in the repo not referenced by the manifest."`
+	Verify          VerifyCmd          `cmd:"" help:"Verify the repo matches its manifest."`
+	Serve           ServeCmd           `cmd:"" help:"Serve the repo over HTTP for testing."`
+	Keygen          KeygenCmd          `cmd:"" help:"Generate a key pair for signing the repo."`
+}
+
+// Load the signing key once flags are parsed, so a bad key fails before any changes.
+func (f *Flags) AfterApply(ctx *kong.Context) error {
+	// Only keygen works without a repo.
+	if f.Repo == "" && ctx.Command() != "keygen" {
+		return errors.New("missing flags: --repo=STRING")
+	}
+
+	if f.SigningKey == "" {
+		return nil
+	}
+	signer, err := readSigningKey(f.SigningKey)
+	if err != nil {
+		return err
+	}
+	app.signer = signer
+	return nil
 }
 
 // Parse the supplied flags.
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+)
+
+type GcCmd struct {
+	Delete bool `help:"Delete the unreferenced files instead of just listing them."`
+	Yes    bool `help:"Don't ask for confirmation." short:"y"`
+}
+
+// Extra help to explain what is considered unreferenced.
+func (a *GcCmd) Help() string {
+	return "Files and directories no release in the manifest references are unreferenced, " +
+		"along with staging directories left by interrupted releases and unreferenced blobs. " +
+		"The manifest, its backup and signature, latest links, channel manifests and the trash are kept."
+}
+
+// Lists or deletes files in the repo which the manifest doesn't reference.
+func (a *GcCmd) Run() error {
+	// Confirm the deletion before locking the repo, so other processes aren't blocked waiting for an answer.
+	confirm := a.Delete && !a.Yes
+	var confirmed []string
+	if confirm {
+		_, orphans, err := findUnreferenced(app.flags.Repo)
+		if err != nil {
+			return err
+		}
+		if _, err = listUnreferenced(app.flags.Repo, orphans); err != nil {
+			return err
+		}
+		if len(orphans) != 0 && !askForConfirmation("Are you sure you want to delete "+strconv.Itoa(len(orphans))+" unreferenced files?") {
+			return errors.New("gc cancelled")
+		}
+		confirmed = orphans
+	}
+
+	// Lock the repo so other processes don't modify it while we are.
+	lock, err := lockRepo(app.flags.Repo)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
+	// Find the unreferenced files again now the repo is locked.
+	manifest, orphans, err := findUnreferenced(app.flags.Repo)
+	if err != nil {
+		return err
+	}
+
+	// Only delete the files which were confirmed, and are still unreferenced.
+	if confirm {
+		orphans = slices.DeleteFunc(orphans, func(orphan string) bool {
+			return !slices.Contains(confirmed, orphan)
+		})
+	}
+
+	// List the unreferenced files with their size.
+	reclaimed, err := listUnreferenced(app.flags.Repo, orphans)
+	if err != nil {
+		return err
+	}
+
+	// Delete the unreferenced files.
+	if a.Delete {
+		for _, orphan := range orphans {
+			err = os.RemoveAll(filepath.Join(app.flags.Repo, orphan))
+			if err != nil {
+				return fmt.Errorf("unable to remove unreferenced file: %s", err)
+			}
+		}
+		log.Println("Removed", len(orphans), "unreferenced files, reclaiming", formatSize(reclaimed))
+	} else {
+		log.Println("Found", len(orphans), "unreferenced files using", formatSize(reclaimed))
+	}
+
+	// Remove blobs no release references.
+	blobsRemoved, blobsReclaimed, err := collectBlobs(app.flags.Repo, manifest, !a.Delete)
+	if err != nil {
+		return fmt.Errorf("unable to collect unreferenced blobs: %s", err)
+	}
+	if blobsRemoved != 0 && a.Delete {
+		log.Println("Removed", blobsRemoved, "unreferenced blobs, reclaiming", formatSize(blobsReclaimed))
+	} else if blobsRemoved != 0 {
+		log.Println("Found", blobsRemoved, "unreferenced blobs using", formatSize(blobsReclaimed))
+	}
+
+	return nil
+}
+
+// Find the files in the repo not referenced by the manifest.
+func findUnreferenced(repo string) (*HttpManifest, []string, error) {
+	// Read existing manifest for repo.
+	manifest, err := readManifestFile(filepath.Join(repo, manifestFileName))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Find the files not referenced by the manifest.
+	orphans, err := findOrphans(repo, manifest)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// When the repo is locked, anything left by an interrupted write is unreferenced.
+	entries, err := os.ReadDir(repo)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, entry := range entries {
+		if isLeftoverFile(entry.Name()) {
+			orphans = append(orphans, entry.Name())
+		}
+	}
+	return manifest, orphans, nil
+}
+
+// Log the unreferenced files with their size, returning the total size.
+func listUnreferenced(repo string, orphans []string) (int64, error) {
+	var total int64
+	for _, orphan := range orphans {
+		size, err := pathSize(filepath.Join(repo, orphan))
+		if err != nil {
+			return 0, err
+		}
+		log.Println("Unreferenced:", orphan, formatSize(size))
+		total += size
+	}
+	return total, nil
+}
@@ -4,5 +4,8 @@ go 1.23
 
 require (
 	github.com/alecthomas/kong v1.2.1
+	golang.org/x/crypto v0.28.0
 	gopkg.in/yaml.v3 v3.0.1
 )
+
+require golang.org/x/sys v0.26.0 // indirect
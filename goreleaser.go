@@ -4,13 +4,25 @@ import (
 	"encoding/json"
 	"os"
 	"time"
+
+	"gopkg.in/yaml.v3"
 )
 
+// The directory in each release the goreleaser metadata is preserved in.
+const releaseMetadataDir = ".goreleaser"
+
 // The metadata needed from goreleaser.
 type Metadata struct {
-	Name    string    `json:"project_name"`
-	Version string    `json:"version"`
-	Date    time.Time `json:"date"`
+	Name        string    `json:"project_name"`
+	Tag         string    `json:"tag"`
+	PreviousTag string    `json:"previous_tag"`
+	Version     string    `json:"version"`
+	Commit      string    `json:"commit"`
+	Date        time.Time `json:"date"`
+	Runtime     struct {
+		Goos   string `json:"goos"`
+		Goarch string `json:"goarch"`
+	} `json:"runtime"`
 }
 
 // Read and parse metadata file
@@ -31,11 +43,49 @@ func readMetadataFile(metadataFile string) (*Metadata, error) {
 	return metadata, err
 }
 
+// Extra artifact details.
+type ArtifactExtra struct {
+	ID       string `json:"ID"`
+	Checksum string `json:"Checksum"`
+}
+
 // Artifcat map.
 type Artifact struct {
-	Name string `json:"name"`
-	Path string `json:"path"`
-	Type string `json:"type"`
+	Name    string        `json:"name"`
+	Path    string        `json:"path"`
+	Goos    string        `json:"goos"`
+	Goarch  string        `json:"goarch"`
+	Goarm   string        `json:"goarm"`
+	Goamd64 string        `json:"goamd64"`
+	Type    string        `json:"type"`
+	Extra   ArtifactExtra `json:"extra"`
+
+	// The original entry, so it can be preserved with all of its fields.
+	raw json.RawMessage
+}
+
+// Decode an artifact, keeping the original entry.
+func (a *Artifact) UnmarshalJSON(data []byte) error {
+	type artifact Artifact
+	err := json.Unmarshal(data, (*artifact)(a))
+	if err != nil {
+		return err
+	}
+	a.raw = append(json.RawMessage(nil), data...)
+	return nil
+}
+
+// The original artifact entry with its path changed.
+func (a *Artifact) WithPath(path string) (map[string]any, error) {
+	entry := make(map[string]any)
+	if a.raw != nil {
+		err := json.Unmarshal(a.raw, &entry)
+		if err != nil {
+			return nil, err
+		}
+	}
+	entry["path"] = path
+	return entry, nil
 }
 
 // Read and parse metadata file
@@ -55,3 +105,37 @@ func readArtifactFile(artifactFile string) ([]*Artifact, error) {
 	// Return the metadata and if any error occurred.
 	return artifacts, err
 }
+
+// Write a preserved artifacts file.
+func writeArtifactFile(artifactFile string, artifacts []map[string]any) error {
+	data, err := json.MarshalIndent(artifacts, "", "    ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(artifactFile, data, 0644)
+}
+
+// The config options needed from goreleaser.
+type Config struct {
+	Checksum struct {
+		Algorithm string `yaml:"algorithm"`
+	} `yaml:"checksum"`
+}
+
+// Read and parse the effective config goreleaser wrote.
+func readConfigFile(configFile string) (*Config, error) {
+	// Read file, if error return the error.
+	yamlFile, err := os.Open(configFile)
+	if err != nil {
+		return nil, err
+	}
+
+	// Attempt to decode the file.
+	config := new(Config)
+	decoder := yaml.NewDecoder(yamlFile)
+	err = decoder.Decode(config)
+	yamlFile.Close()
+
+	// Return the config and if any error occurred.
+	return config, err
+}
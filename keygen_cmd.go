@@ -0,0 +1,60 @@
+package main
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"log"
+	"os"
+)
+
+type KeygenCmd struct {
+	Type  string `help:"Type of key to generate." enum:"ecdsa,ed25519" default:"ecdsa"`
+	Out   string `help:"Base path for the key files, the private key gets .key and the public key .pub appended." default:"signing"`
+	Force bool   `help:"Overwrite existing key files."`
+}
+
+// Generates a key pair for signing the repo.
+func (a *KeygenCmd) Run() error {
+	keyFile := a.Out + ".key"
+	pubFile := a.Out + ".pub"
+
+	// Don't overwrite keys unless asked to.
+	if !a.Force {
+		for _, path := range []string{keyFile, pubFile} {
+			if _, err := os.Stat(path); err == nil {
+				return errors.New("key file " + path + " already exists")
+			}
+		}
+	}
+
+	// Generate the key.
+	key, err := generateSigningKey(a.Type)
+	if err != nil {
+		return err
+	}
+
+	// Encode the private key as PKCS #8 and the public key as PKIX.
+	keyData, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return err
+	}
+	pubData, err := x509.MarshalPKIXPublicKey(key.Public())
+	if err != nil {
+		return err
+	}
+
+	// Write the key files, keeping the private key private.
+	err = os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyData}), 0600)
+	if err != nil {
+		return err
+	}
+	err = os.WriteFile(pubFile, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubData}), 0644)
+	if err != nil {
+		return err
+	}
+
+	log.Println("Generated", a.Type, "key pair", keyFile, "and", pubFile)
+
+	return nil
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+	"time"
+)
+
+type ListCmd struct {
+	Output  string `help:"Output format." enum:"table,json,yaml" default:"table" short:"o"`
+	Channel string `help:"Only list releases in this channel."`
+}
+
+// A summary of a release for listing.
+type ReleaseSummary struct {
+	TagName     string    `yaml:"tag_name" json:"tag_name"`
+	ID          int64     `yaml:"id" json:"id"`
+	Draft       bool      `yaml:"draft" json:"draft"`
+	Prerelease  bool      `yaml:"prerelease" json:"prerelease"`
+	Channel     string    `yaml:"channel,omitempty" json:"channel,omitempty"`
+	Pinned      bool      `yaml:"pinned" json:"pinned"`
+	PublishedAt time.Time `yaml:"published_at" json:"published_at"`
+	Assets      int       `yaml:"assets" json:"assets"`
+	Size        int64     `yaml:"size" json:"size"`
+	Latest      bool      `yaml:"latest" json:"latest"`
+}
+
+// Lists the releases in a repo.
+func (a *ListCmd) Run() error {
+	// Read existing manifest for repo.
+	manifest, err := readManifestFile(filepath.Join(app.flags.Repo, manifestFileName))
+	if err != nil {
+		return err
+	}
+	latest := readLatestLink(app.flags.Repo, latestLinkName)
+
+	// If listing a channel, latest is the channel's latest.
+	if a.Channel != "" {
+		manifest = manifest.ChannelView(a.Channel)
+		latest = readLatestLink(app.flags.Repo, latestLinkName+"-"+a.Channel)
+	}
+
+	// Summarize each release.
+	summaries := []*ReleaseSummary{}
+	for _, release := range manifest.Releases {
+		summary := &ReleaseSummary{
+			TagName:     release.TagName,
+			ID:          release.ID,
+			Draft:       release.Draft,
+			Prerelease:  release.Prerelease,
+			Channel:     release.Channel,
+			Pinned:      release.Pinned,
+			PublishedAt: release.PublishedAt,
+			Assets:      len(release.Assets),
+			Size:        release.Size(),
+			Latest:      release.URL == latest,
+		}
+		summaries = append(summaries, summary)
+	}
+
+	// Structured output is for scripts.
+	if a.Output != "table" {
+		return writeOutput(os.Stdout, a.Output, summaries)
+	}
+
+	// Print a table of the releases.
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TAG\tID\tDRAFT\tPRERELEASE\tCHANNEL\tPINNED\tPUBLISHED\tASSETS\tSIZE\tLATEST")
+	for _, summary := range summaries {
+		latestMark := ""
+		if summary.Latest {
+			latestMark = "*"
+		}
+		fmt.Fprintf(w, "%s\t%d\t%t\t%t\t%s\t%t\t%s\t%d\t%s\t%s\n",
+			summary.TagName,
+			summary.ID,
+			summary.Draft,
+			summary.Prerelease,
+			summary.Channel,
+			summary.Pinned,
+			summary.PublishedAt.Format(time.RFC3339),
+			summary.Assets,
+			formatSize(summary.Size),
+			latestMark,
+		)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"time"
+)
+
+// Locks older than this are stale where the holder can't be checked, such as after a crash.
+const staleLockAge = 24 * time.Hour
+
+// The process holding a repo lock, recorded in the lock file.
+type lockInfo struct {
+	PID    int
+	Locked time.Time
+}
+
+// Record this process as the holder of the lock.
+func writeLockInfo(f *os.File) error {
+	err := f.Truncate(0)
+	if err == nil {
+		_, err = fmt.Fprintf(f, "%d %s\n", os.Getpid(), time.Now().UTC().Format(time.RFC3339))
+	}
+	return err
+}
+
+// Read the holder of a lock from the lock file.
+func readLockInfo(path string) (*lockInfo, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var pid int
+	var locked string
+	_, err = fmt.Sscan(string(data), &pid, &locked)
+	if err != nil {
+		return nil, fmt.Errorf("invalid lock file: %s", err)
+	}
+	info := &lockInfo{PID: pid}
+	info.Locked, err = time.Parse(time.RFC3339, locked)
+	if err != nil {
+		return nil, fmt.Errorf("invalid lock file: %s", err)
+	}
+	return info, nil
+}
+
+// Describe the lock holder for people waiting on it.
+func (l *lockInfo) String() string {
+	return fmt.Sprintf("process %d, which locked the repo at %s,", l.PID, l.Locked.Local().Format(time.DateTime))
+}
+
+// Was the lock left by a process which is gone, or so long ago it was abandoned?
+func (l *lockInfo) stale(now time.Time, running func(pid int) bool) bool {
+	return !running(l.PID) || now.Sub(l.Locked) > staleLockAge
+}
+
+// Tell the user we're waiting on the lock, and who holds it if known.
+func logLockWait(path string) {
+	info, err := readLockInfo(path)
+	if err != nil {
+		log.Println("Waiting for another process to release the repo lock.")
+		return
+	}
+	log.Println("Waiting for", info, "to release the repo lock.")
+}
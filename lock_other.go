@@ -0,0 +1,80 @@
+//go:build !unix
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// An exclusive lock held on a repo.
+type RepoLock struct {
+	path string
+}
+
+// Take an exclusive lock on the repo, waiting for other holders to release it.
+// Without flock, the lock is the existence of the lock file, which records its holder
+// so a lock left by a crashed process can be detected and removed.
+func lockRepo(repo string) (*RepoLock, error) {
+	path := filepath.Join(repo, lockFileName)
+	waiting := false
+	for {
+		f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0644)
+		if err == nil {
+			err = writeLockInfo(f)
+			f.Close()
+			if err != nil {
+				os.Remove(path)
+				return nil, fmt.Errorf("unable to lock repo: %s", err)
+			}
+			return &RepoLock{path: path}, nil
+		}
+		if !os.IsExist(err) {
+			return nil, fmt.Errorf("unable to lock repo: %s", err)
+		}
+
+		// Remove the lock if its holder is gone.
+		if isStaleLockFile(path) {
+			log.Println("Removing a stale repo lock left by a process which is no longer running.")
+			os.Remove(path)
+			continue
+		}
+
+		// Someone else holds the lock, wait for it.
+		if !waiting {
+			logLockWait(path)
+			waiting = true
+		}
+		time.Sleep(250 * time.Millisecond)
+	}
+}
+
+// Is the lock file left by a process which is gone?
+func isStaleLockFile(path string) bool {
+	info, err := readLockInfo(path)
+	if err == nil {
+		return info.stale(time.Now(), processRunning)
+	}
+
+	// The holder may not have recorded itself yet, so only an old lock file without details is stale.
+	stat, err := os.Stat(path)
+	return err == nil && time.Since(stat.ModTime()) > staleLockAge
+}
+
+// Is a process running? Where this can't be checked, it's assumed to be.
+func processRunning(pid int) bool {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	p.Release()
+	return true
+}
+
+// Release the lock on the repo.
+func (l *RepoLock) Unlock() error {
+	return os.Remove(l.path)
+}
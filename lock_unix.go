@@ -0,0 +1,54 @@
+//go:build unix
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// An exclusive advisory lock held on a repo.
+type RepoLock struct {
+	file *os.File
+}
+
+// Take an exclusive lock on the repo, waiting for other holders to release it.
+func lockRepo(repo string) (*RepoLock, error) {
+	// Open the lock file, creating it if needed.
+	path := filepath.Join(repo, lockFileName)
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open repo lock: %s", err)
+	}
+
+	// Try to take the lock without blocking so we can tell the user if we need to wait.
+	err = syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if errors.Is(err, syscall.EWOULDBLOCK) {
+		logLockWait(path)
+		err = syscall.Flock(int(f.Fd()), syscall.LOCK_EX)
+	}
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("unable to lock repo: %s", err)
+	}
+
+	// Record who holds the lock for anyone waiting on it.
+	err = writeLockInfo(f)
+	if err != nil {
+		syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+		f.Close()
+		return nil, fmt.Errorf("unable to lock repo: %s", err)
+	}
+
+	return &RepoLock{file: f}, nil
+}
+
+// Release the lock on the repo.
+func (l *RepoLock) Unlock() error {
+	err := syscall.Flock(int(l.file.Fd()), syscall.LOCK_UN)
+	l.file.Close()
+	return err
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"crypto"
 	"time"
 )
 
@@ -12,8 +13,9 @@ const (
 
 // App is the global application structure for communicating between servers and storing information.
 type App struct {
-	flags *Flags
-	now   time.Time
+	flags  *Flags
+	now    time.Time
+	signer crypto.Signer
 }
 
 var app *App
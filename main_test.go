@@ -1,10 +1,27 @@
 package main
 
 import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/md5"
+	"crypto/sha256"
+	"crypto/x509"
 	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"maps"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -82,7 +99,7 @@ func TestAppFunctionality(t *testing.T) {
 	hfun.Write(d)
 	sum := hfun.Sum(nil)
 	hash := hex.EncodeToString(sum)
-	if hash != "19a3a502913252635b3e0ea838846197" {
+	if hash != "782d585a8df3ee9e294dc9db4a1abcec" {
 		t.Errorf("hash isn't valid for manifest file: %s", hash)
 	}
 
@@ -187,7 +204,7 @@ func TestAppFunctionality(t *testing.T) {
 	hfun.Write(d)
 	sum = hfun.Sum(nil)
 	hash = hex.EncodeToString(sum)
-	if hash != "999c4156c2b5ff25f3491b86c8255cb5" {
+	if hash != "47c45e278e204ae34d7347ba353f4f6f" {
 		t.Errorf("hash isn't valid for manifest file: %s", hash)
 	}
 
@@ -222,3 +239,1719 @@ func TestAppFunctionality(t *testing.T) {
 	// Cleanup.
 	os.RemoveAll(dname)
 }
+
+// Run the app with the provided arguments.
+func runTestApp(now time.Time, args ...string) error {
+	os.Args = append([]string{"test"}, args...)
+	app = new(App)
+	app.now = now
+	ctx := app.ParseFlags()
+	return ctx.Run()
+}
+
+// Copy a test release to a temp directory so it can be modified.
+func copyTestRelease(t *testing.T, name string) string {
+	dname := t.TempDir()
+	src := filepath.Join("tests", name)
+	err := filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(src, path)
+		if info.IsDir() {
+			return os.MkdirAll(filepath.Join(dname, name, rel), 0755)
+		}
+		return copyFile(path, filepath.Join(dname, name, rel))
+	})
+	if err != nil {
+		t.Fatalf("error copying test release: %s", err)
+	}
+	return filepath.Join(dname, name)
+}
+
+// Test artifact checksums are verified when adding a release.
+func TestChecksumVerification(t *testing.T) {
+	dname := t.TempDir()
+	now, _ := time.Parse(time.DateOnly, "2024-10-08")
+
+	// Corrupt the checksums file of a release.
+	release := copyTestRelease(t, "v0.1.1")
+	err := os.WriteFile(filepath.Join(release, "checksums.txt"), []byte("0000000000000000000000000000000000000000000000000000000000000000  example_linux_amd64.tar.gz\n"), 0644)
+	if err != nil {
+		t.Fatalf("error writing checksums file: %s", err)
+	}
+
+	// Adding the release should fail.
+	err = runTestApp(now, "--repo", dname, "add-release", "--release", release)
+	if err == nil {
+		t.Error("add-release succeeded with a bad checksum")
+	}
+	if _, serr := os.Stat(filepath.Join(dname, "v0.1.1")); !os.IsNotExist(serr) {
+		t.Error("v0.1.1 exists after a failed add-release.")
+	}
+
+	// Adding with only warnings should succeed.
+	err = runTestApp(now, "--repo", dname, "add-release", "--checksum-warn", "--release", release)
+	if err != nil {
+		t.Errorf("error running the app: %s", err)
+	}
+	if _, serr := os.Stat(filepath.Join(dname, "v0.1.1/example_linux_amd64.tar.gz")); serr != nil {
+		t.Error("v0.1.1 does not exist, when it should.")
+	}
+
+	// Checksums with unsupported algorithms fail, unless only warning.
+	dname = t.TempDir()
+	release = copyTestRelease(t, "v0.1.1")
+	err = os.WriteFile(filepath.Join(release, "config.yaml"), []byte("checksum:\n  algorithm: crc32\n"), 0644)
+	if err != nil {
+		t.Fatalf("error writing config file: %s", err)
+	}
+	err = runTestApp(now, "--repo", dname, "add-release", "--release", release)
+	if err == nil {
+		t.Error("add-release succeeded with an unsupported checksum algorithm")
+	}
+	err = runTestApp(now, "--repo", dname, "add-release", "--checksum-warn", "--release", release)
+	if err != nil {
+		t.Errorf("error running the app: %s", err)
+	}
+
+	// All the SHA-2 algorithms goreleaser offers are supported.
+	for _, algorithm := range []string{"sha224", "sha256", "sha384", "sha512"} {
+		if _, err := newChecksumHash(algorithm); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+// Test releases are staged and swapped into place.
+func TestStagedRelease(t *testing.T) {
+	dname := t.TempDir()
+	testsDir, _ := filepath.Abs("tests")
+	now, _ := time.Parse(time.DateOnly, "2024-10-08")
+
+	// Add a release.
+	err := runTestApp(now, "--repo", dname, "add-release", "--release", filepath.Join(testsDir, "v0.1"))
+	if err != nil {
+		t.Fatalf("error running the app: %s", err)
+	}
+
+	// The release directory must be readable by a web server running as another user.
+	stat, err := os.Stat(filepath.Join(dname, "v0.1.0"))
+	if err != nil {
+		t.Fatalf("error reading release directory: %s", err)
+	}
+	if stat.Mode().Perm() != 0755 {
+		t.Errorf("release directory has mode %s, expected %s", stat.Mode().Perm(), os.FileMode(0755))
+	}
+
+	// Add a newer release to replace.
+	err = runTestApp(now, "--repo", dname, "add-release", "--release", filepath.Join(testsDir, "v0.1.1"))
+	if err != nil {
+		t.Fatalf("error running the app: %s", err)
+	}
+
+	// Read the state of the repo a failed replace must leave unchanged.
+	snapshot := func() map[string]string {
+		files := make(map[string]string)
+		err := filepath.Walk(filepath.Join(dname, "v0.1.1"), func(path string, info os.FileInfo, err error) error {
+			if err != nil || info.IsDir() {
+				return err
+			}
+			d, err := os.ReadFile(path)
+			files[path] = string(d)
+			return err
+		})
+		if err != nil {
+			t.Fatalf("error reading release directory: %s", err)
+		}
+		manifest, _ := os.ReadFile(filepath.Join(dname, manifestFileName))
+		files[manifestFileName] = string(manifest)
+		files[latestLinkName] = readLatestLink(dname, latestLinkName)
+		return files
+	}
+	before := snapshot()
+	if before[latestLinkName] != "v0.1.1" {
+		t.Fatalf("the latest link isn't correctly linked: %s", before[latestLinkName])
+	}
+
+	// A replace which fails while staging leaves the existing release in place.
+	release := copyTestRelease(t, "v0.1.1")
+	err = os.WriteFile(filepath.Join(release, "checksums.txt"), []byte("0000000000000000000000000000000000000000000000000000000000000000  example_linux_amd64.tar.gz\n"), 0644)
+	if err != nil {
+		t.Fatalf("error writing checksums file: %s", err)
+	}
+	err = runTestApp(now, "--repo", dname, "add-release", "--force", "--release", release)
+	if err == nil {
+		t.Error("add-release succeeded with a bad checksum")
+	}
+	if after := snapshot(); !maps.Equal(before, after) {
+		t.Error("the repo changed after a failed replace while staging")
+	}
+
+	// A replace which fails after the release is swapped in is rolled back.
+	// The prerelease would move latest back to v0.1.0, and a directory in place of
+	// the channel manifest makes updating the links fail.
+	err = os.Mkdir(filepath.Join(dname, channelManifestFileName("beta")), 0755)
+	if err != nil {
+		t.Fatalf("error making directory: %s", err)
+	}
+	err = runTestApp(now, "--repo", dname, "add-release", "--force", "--prerelease", "--channel", "beta", "--release", filepath.Join(testsDir, "v0.1.1"))
+	if err == nil {
+		t.Error("add-release succeeded when the links couldn't be updated")
+	}
+	if after := snapshot(); !maps.Equal(before, after) {
+		t.Error("the repo changed after a failed replace was rolled back")
+	}
+
+	// No staging directories are left behind.
+	matches, _ := filepath.Glob(filepath.Join(dname, ".staging-*"))
+	if len(matches) != 0 {
+		t.Errorf("staging directories left in the repo: %v", matches)
+	}
+}
+
+// Test removing a release from the repo.
+func TestRemoveRelease(t *testing.T) {
+	dname := t.TempDir()
+	testsDir, _ := filepath.Abs("tests")
+	now, _ := time.Parse(time.DateOnly, "2024-10-08")
+
+	// Add the test releases.
+	for _, release := range []string{"v0.1", "v0.1.1", "v0.1.2"} {
+		err := runTestApp(now, "--repo", dname, "add-release", "--release", filepath.Join(testsDir, release))
+		if err != nil {
+			t.Fatalf("error running the app: %s", err)
+		}
+	}
+
+	// A dry run should not change anything.
+	err := runTestApp(now, "--repo", dname, "remove-release", "--tag", "v0.1.2", "--dry-run")
+	if err != nil {
+		t.Errorf("error running the app: %s", err)
+	}
+	if _, serr := os.Stat(filepath.Join(dname, "v0.1.2")); serr != nil {
+		t.Error("v0.1.2 does not exist after a dry run.")
+	}
+
+	// Without an answer to the confirmation, nothing should be removed.
+	stdin := os.Stdin
+	os.Stdin, err = os.Open(os.DevNull)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = runTestApp(now, "--repo", dname, "remove-release", "--tag", "v0.1.2")
+	os.Stdin.Close()
+	os.Stdin = stdin
+	if err == nil {
+		t.Error("remove-release succeeded without confirmation")
+	}
+	if _, serr := os.Stat(filepath.Join(dname, "v0.1.2")); serr != nil {
+		t.Error("v0.1.2 does not exist after cancelling.")
+	}
+
+	// Remove the latest release.
+	err = runTestApp(now, "--repo", dname, "remove-release", "--tag", "v0.1.2", "--yes")
+	if err != nil {
+		t.Errorf("error running the app: %s", err)
+	}
+	if _, serr := os.Stat(filepath.Join(dname, "v0.1.2")); !os.IsNotExist(serr) {
+		t.Error("v0.1.2 exists, when it shouldn't exist.")
+	}
+	manifest, err := readManifestFile(filepath.Join(dname, manifestFileName))
+	if err != nil {
+		t.Fatalf("error reading manifest file: %s", err)
+	}
+	if manifest.FindRelease("v0.1.2") != -1 {
+		t.Error("v0.1.2 is still in the manifest.")
+	}
+
+	// Latest should move to the next newest release.
+	if latest := readLatestLink(dname, latestLinkName); latest != "v0.1.1" {
+		t.Errorf("the latest link isn't correctly linked: %s", latest)
+	}
+
+	// Removing an unknown release should fail.
+	err = runTestApp(now, "--repo", dname, "remove-release", "--tag", "v9.9.9", "--yes")
+	if err == nil {
+		t.Error("removing an unknown release succeeded")
+	}
+}
+
+// Test promoting and demoting releases.
+func TestPromoteRelease(t *testing.T) {
+	dname := t.TempDir()
+	testsDir, _ := filepath.Abs("tests")
+	now, _ := time.Parse(time.DateOnly, "2024-10-08")
+
+	// Add a stable release and a draft.
+	err := runTestApp(now, "--repo", dname, "add-release", "--release", filepath.Join(testsDir, "v0.1"))
+	if err != nil {
+		t.Fatalf("error running the app: %s", err)
+	}
+	err = runTestApp(now, "--repo", dname, "add-release", "--draft", "--release", filepath.Join(testsDir, "v0.1.1"))
+	if err != nil {
+		t.Fatalf("error running the app: %s", err)
+	}
+	if latest := readLatestLink(dname, latestLinkName); latest != "v0.1.0" {
+		t.Errorf("the latest link isn't correctly linked: %s", latest)
+	}
+
+	// Promote the draft.
+	err = runTestApp(now, "--repo", dname, "promote", "--tag", "v0.1.1", "--bump-date")
+	if err != nil {
+		t.Errorf("error running the app: %s", err)
+	}
+	if latest := readLatestLink(dname, latestLinkName); latest != "v0.1.1" {
+		t.Errorf("the latest link isn't correctly linked: %s", latest)
+	}
+	manifest, err := readManifestFile(filepath.Join(dname, manifestFileName))
+	if err != nil {
+		t.Fatalf("error reading manifest file: %s", err)
+	}
+	release := manifest.Releases[manifest.FindRelease("v0.1.1")]
+	if release.Draft || release.Prerelease || !release.PublishedAt.Equal(now) {
+		t.Error("v0.1.1 wasn't promoted correctly.")
+	}
+
+	// Demote it back to a prerelease.
+	err = runTestApp(now, "--repo", dname, "demote", "--tag", "v0.1.1", "--prerelease")
+	if err != nil {
+		t.Errorf("error running the app: %s", err)
+	}
+	if latest := readLatestLink(dname, latestLinkName); latest != "v0.1.0" {
+		t.Errorf("the latest link isn't correctly linked: %s", latest)
+	}
+}
+
+// Test semantic version ordering.
+func TestVersionCompare(t *testing.T) {
+	ordered := []string{
+		"v1.0.0-alpha",
+		"v1.0.0-alpha.1",
+		"v1.0.0-alpha.beta",
+		"v1.0.0-beta",
+		"v1.0.0-beta.2",
+		"v1.0.0-beta.11",
+		"v1.0.0-rc.1",
+		"v1.0.0",
+		"v1.4.9",
+		"v1.5.0+build.5",
+		"v1.10.0",
+	}
+	for i := 0; i < len(ordered)-1; i++ {
+		a, err := parseVersion(ordered[i])
+		if err != nil {
+			t.Fatalf("error parsing version: %s", err)
+		}
+		b, err := parseVersion(ordered[i+1])
+		if err != nil {
+			t.Fatalf("error parsing version: %s", err)
+		}
+		if a.Compare(b) != -1 || b.Compare(a) != 1 {
+			t.Errorf("%s should be lower than %s", ordered[i], ordered[i+1])
+		}
+	}
+
+	// Invalid versions should fail to parse.
+	for _, version := range []string{"v1.0", "v01.0.0", "latest", "v1.0.0-"} {
+		if _, err := parseVersion(version); err == nil {
+			t.Errorf("%s parsed as a valid version", version)
+		}
+	}
+}
+
+// Test that adding an older release doesn't move latest backwards.
+func TestBackportRelease(t *testing.T) {
+	dname := t.TempDir()
+	testsDir, _ := filepath.Abs("tests")
+	now, _ := time.Parse(time.DateOnly, "2024-10-08")
+
+	// Add the newer release first, then the older one.
+	for _, release := range []string{"v0.1.2", "v0.1.1"} {
+		err := runTestApp(now, "--repo", dname, "add-release", "--release", filepath.Join(testsDir, release))
+		if err != nil {
+			t.Fatalf("error running the app: %s", err)
+		}
+	}
+
+	// Latest should still be the highest version, and the manifest sorted.
+	if latest := readLatestLink(dname, latestLinkName); latest != "v0.1.2" {
+		t.Errorf("the latest link isn't correctly linked: %s", latest)
+	}
+	manifest, err := readManifestFile(filepath.Join(dname, manifestFileName))
+	if err != nil {
+		t.Fatalf("error reading manifest file: %s", err)
+	}
+	if manifest.Releases[0].TagName != "v0.1.1" || manifest.Releases[1].TagName != "v0.1.2" {
+		t.Error("the manifest isn't sorted by version")
+	}
+}
+
+// Test serving a repo over HTTP.
+func TestServe(t *testing.T) {
+	dname := t.TempDir()
+	testsDir, _ := filepath.Abs("tests")
+	now, _ := time.Parse(time.DateOnly, "2024-10-08")
+
+	// Add a release and remove the latest link, it should be resolved from the manifest.
+	err := runTestApp(now, "--repo", dname, "add-release", "--release", filepath.Join(testsDir, "v0.1"))
+	if err != nil {
+		t.Fatalf("error running the app: %s", err)
+	}
+	os.Remove(filepath.Join(dname, latestLinkName))
+	server := httptest.NewServer(newRepoHandler(dname))
+	defer server.Close()
+
+	// Request the latest asset.
+	res, err := http.Get(server.URL + "/latest/example_linux_amd64.tar.gz")
+	if err != nil {
+		t.Fatalf("error requesting asset: %s", err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("unexpected status for latest asset: %d", res.StatusCode)
+	}
+	if res.Header.Get("Content-Type") != "application/gzip" {
+		t.Errorf("unexpected content type: %s", res.Header.Get("Content-Type"))
+	}
+	etag := res.Header.Get("ETag")
+	if etag == "" || res.Header.Get("Last-Modified") == "" {
+		t.Error("cache headers are missing")
+	}
+
+	// A matching ETag should not be modified.
+	req, _ := http.NewRequest(http.MethodGet, server.URL+"/v0.1.0/example_linux_amd64.tar.gz", nil)
+	req.Header.Set("If-None-Match", etag)
+	res, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("error requesting asset: %s", err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusNotModified {
+		t.Errorf("unexpected status for conditional request: %d", res.StatusCode)
+	}
+
+	// Range requests should return part of the file.
+	req, _ = http.NewRequest(http.MethodGet, server.URL+"/v0.1.0/example_linux_amd64.tar.gz", nil)
+	req.Header.Set("Range", "bytes=0-9")
+	res, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("error requesting asset: %s", err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusPartialContent || res.ContentLength != 10 {
+		t.Errorf("unexpected response for range request: %d %d", res.StatusCode, res.ContentLength)
+	}
+
+	// Internal files should not be served.
+	res, err = http.Get(server.URL + "/" + lockFileName)
+	if err != nil {
+		t.Fatalf("error requesting lock file: %s", err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusNotFound {
+		t.Errorf("unexpected status for lock file: %d", res.StatusCode)
+	}
+}
+
+// Test signing the manifest and assets.
+func TestSigning(t *testing.T) {
+	dname := t.TempDir()
+	testsDir, _ := filepath.Abs("tests")
+	now, _ := time.Parse(time.DateOnly, "2024-10-08")
+
+	for _, keyType := range []string{"ecdsa", "ed25519"} {
+		// Generate a key pair.
+		keyBase := filepath.Join(t.TempDir(), "signing")
+		err := runTestApp(now, "keygen", "--type", keyType, "--out", keyBase)
+		if err != nil {
+			t.Fatalf("error running the app: %s", err)
+		}
+		pubData, err := os.ReadFile(keyBase + ".pub")
+		if err != nil {
+			t.Fatalf("error reading public key: %s", err)
+		}
+		block, _ := pem.Decode(pubData)
+		pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			t.Fatalf("error parsing public key: %s", err)
+		}
+
+		// Verify a file against its signature.
+		verify := func(path string) bool {
+			data, _ := os.ReadFile(path)
+			sig, err := os.ReadFile(path + signatureSuffix)
+			if err != nil {
+				return false
+			}
+			switch k := pub.(type) {
+			case ed25519.PublicKey:
+				return ed25519.Verify(k, data, sig)
+			case *ecdsa.PublicKey:
+				digest := sha256.Sum256(data)
+				return ecdsa.VerifyASN1(k, digest[:], sig)
+			}
+			return false
+		}
+
+		// Add a signed release.
+		err = runTestApp(now, "--repo", dname, "--signing-key", keyBase+".key", "add-release", "--force", "--release", filepath.Join(testsDir, "v0.1"))
+		if err != nil {
+			t.Fatalf("error running the app: %s", err)
+		}
+		if !verify(filepath.Join(dname, manifestFileName)) {
+			t.Errorf("%s manifest signature isn't valid", keyType)
+		}
+		if !verify(filepath.Join(dname, "v0.1.0/example_linux_amd64.tar.gz")) {
+			t.Errorf("%s asset signature isn't valid", keyType)
+		}
+		manifest, err := readManifestFile(filepath.Join(dname, manifestFileName))
+		if err != nil {
+			t.Fatalf("error reading manifest file: %s", err)
+		}
+		found := false
+		for _, asset := range manifest.Releases[0].Assets {
+			if asset.Name == "example_linux_amd64.tar.gz"+signatureSuffix {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("%s asset signature isn't in the manifest", keyType)
+		}
+
+		// Modifying the signed repo requires the key, so the signature never goes stale.
+		err = runTestApp(now, "--repo", dname, "pin", "--tag", "v0.1.0")
+		if err == nil {
+			t.Errorf("%s signed repo was modified without the key", keyType)
+		}
+		err = runTestApp(now, "--repo", dname, "--signing-key", keyBase+".key", "pin", "--tag", "v0.1.0")
+		if err != nil {
+			t.Fatalf("error running the app: %s", err)
+		}
+		if !verify(filepath.Join(dname, manifestFileName)) {
+			t.Errorf("%s manifest signature isn't valid after pinning", keyType)
+		}
+	}
+}
+
+// Test verifying a repo against its manifest.
+func TestVerify(t *testing.T) {
+	dname := t.TempDir()
+	testsDir, _ := filepath.Abs("tests")
+	now, _ := time.Parse(time.DateOnly, "2024-10-08")
+
+	// Add the test releases.
+	for _, release := range []string{"v0.1", "v0.1.1"} {
+		err := runTestApp(now, "--repo", dname, "add-release", "--release", filepath.Join(testsDir, release))
+		if err != nil {
+			t.Fatalf("error running the app: %s", err)
+		}
+	}
+
+	// A fresh repo should verify.
+	err := runTestApp(now, "--repo", dname, "verify")
+	if err != nil {
+		t.Errorf("error verifying the repo: %s", err)
+	}
+
+	// A corrupted asset should fail.
+	asset := filepath.Join(dname, "v0.1.1/example_linux_amd64.tar.gz")
+	data, _ := os.ReadFile(asset)
+	data[0]++
+	os.WriteFile(asset, data, 0644)
+	err = runTestApp(now, "--repo", dname, "verify")
+	if err == nil {
+		t.Error("verify passed with a corrupted asset")
+	}
+	data[0]--
+	os.WriteFile(asset, data, 0644)
+
+	// An orphaned directory should fail.
+	os.Mkdir(filepath.Join(dname, "v9.9.9"), 0755)
+	err = runTestApp(now, "--repo", dname, "verify")
+	if err == nil {
+		t.Error("verify passed with an orphaned directory")
+	}
+	os.Remove(filepath.Join(dname, "v9.9.9"))
+
+	// Channel links and manifests should match the manifest.
+	err = runTestApp(now, "--repo", dname, "add-release", "--channel", "beta", "--prerelease", "--release", filepath.Join(testsDir, "v0.1.2"))
+	if err != nil {
+		t.Fatalf("error running the app: %s", err)
+	}
+	if err = runTestApp(now, "--repo", dname, "verify"); err != nil {
+		t.Errorf("error verifying the repo: %s", err)
+	}
+	channelFile := filepath.Join(dname, channelManifestFileName("beta"))
+	channelData, _ := os.ReadFile(channelFile)
+	os.WriteFile(channelFile, []byte("releases: []\n"), 0644)
+	if err = runTestApp(now, "--repo", dname, "verify"); err == nil {
+		t.Error("verify passed with a stale channel manifest")
+	}
+	os.WriteFile(channelFile, channelData, 0644)
+	os.Remove(filepath.Join(dname, latestLinkName+"-beta"))
+	if err = runTestApp(now, "--repo", dname, "verify"); err == nil {
+		t.Error("verify passed with a missing channel latest link")
+	}
+	os.Symlink("v0.1.2", filepath.Join(dname, latestLinkName+"-beta"))
+	os.Symlink("v0.1.0", filepath.Join(dname, latestLinkName+"-gone"))
+	if err = runTestApp(now, "--repo", dname, "verify"); err == nil {
+		t.Error("verify passed with a link for a channel without releases")
+	}
+	os.Remove(filepath.Join(dname, latestLinkName+"-gone"))
+
+	// Signatures should be checked with the public key.
+	keyBase := filepath.Join(t.TempDir(), "signing")
+	err = runTestApp(now, "keygen", "--out", keyBase)
+	if err != nil {
+		t.Fatalf("error running the app: %s", err)
+	}
+	err = runTestApp(now, "--repo", dname, "--signing-key", keyBase+".key", "pin", "--tag", "v0.1.0")
+	if err != nil {
+		t.Fatalf("error running the app: %s", err)
+	}
+	if err = runTestApp(now, "--repo", dname, "verify", "--public-key", keyBase+".pub"); err != nil {
+		t.Errorf("error verifying the repo: %s", err)
+	}
+	os.WriteFile(filepath.Join(dname, manifestFileName+signatureSuffix), []byte("bad"), 0644)
+	if err = runTestApp(now, "--repo", dname, "verify", "--public-key", keyBase+".pub"); err == nil {
+		t.Error("verify passed with an invalid signature")
+	}
+
+	// Missing release files and a broken latest link should fail.
+	os.RemoveAll(filepath.Join(dname, "v0.1.1"))
+	err = runTestApp(now, "--repo", dname, "verify")
+	if err == nil {
+		t.Error("verify passed with missing release files")
+	}
+}
+
+// Test rebuilding a lost manifest.
+func TestRebuildManifest(t *testing.T) {
+	dname := t.TempDir()
+	testsDir, _ := filepath.Abs("tests")
+	now, _ := time.Parse(time.DateOnly, "2024-10-08")
+
+	// Add the test releases.
+	for _, release := range []string{"v0.1", "v0.1.1"} {
+		err := runTestApp(now, "--repo", dname, "add-release", "--release", filepath.Join(testsDir, release))
+		if err != nil {
+			t.Fatalf("error running the app: %s", err)
+		}
+	}
+
+	// Lose the manifest, adding a release should refuse to start a new one.
+	os.Remove(filepath.Join(dname, manifestFileName))
+	err := runTestApp(now, "--repo", dname, "add-release", "--release", filepath.Join(testsDir, "v0.1.2"))
+	if err == nil {
+		t.Error("add-release started a new manifest over existing releases")
+	}
+
+	// A dry run should not write the manifest.
+	err = runTestApp(now, "--repo", dname, "rebuild-manifest", "--dry-run")
+	if err != nil {
+		t.Errorf("error running the app: %s", err)
+	}
+	if _, serr := os.Stat(filepath.Join(dname, manifestFileName)); !os.IsNotExist(serr) {
+		t.Error("the manifest was written on a dry run")
+	}
+
+	// Rebuild the manifest.
+	err = runTestApp(now, "--repo", dname, "rebuild-manifest")
+	if err != nil {
+		t.Errorf("error running the app: %s", err)
+	}
+	manifest, err := readManifestFile(filepath.Join(dname, manifestFileName))
+	if err != nil {
+		t.Fatalf("error reading manifest file: %s", err)
+	}
+	if len(manifest.Releases) != 2 || manifest.Releases[1].TagName != "v0.1.1" || len(manifest.Releases[1].Assets) != 3 {
+		t.Error("the manifest wasn't rebuilt correctly")
+	}
+	if manifest.Releases[1].Commit != "521be63afb85d785ce36b4bd0d7412664593ac1d" || manifest.Releases[1].Assets[1].Type != "Archive" {
+		t.Error("the preserved goreleaser metadata wasn't used")
+	}
+	if manifest.LastReleaseID != 2 || manifest.LastAssetID != 6 {
+		t.Errorf("the manifest IDs weren't rebuilt correctly: %d %d", manifest.LastReleaseID, manifest.LastAssetID)
+	}
+
+	// The rebuilt repo should verify.
+	err = runTestApp(now, "--repo", dname, "verify")
+	if err != nil {
+		t.Errorf("error verifying the repo: %s", err)
+	}
+
+	// A corrupt manifest is rebuilt from its backup, so drafts stay drafts.
+	err = runTestApp(now, "--repo", dname, "edit-release", "--tag", "v0.1.1", "--draft")
+	if err != nil {
+		t.Fatalf("error running the app: %s", err)
+	}
+	err = runTestApp(now, "--repo", dname, "pin", "--tag", "v0.1.0")
+	if err != nil {
+		t.Fatalf("error running the app: %s", err)
+	}
+	err = os.WriteFile(filepath.Join(dname, manifestFileName), []byte("releases: [\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = runTestApp(now, "--repo", dname, "rebuild-manifest")
+	if err != nil {
+		t.Fatalf("error running the app: %s", err)
+	}
+	manifest, err = readManifestFile(filepath.Join(dname, manifestFileName))
+	if err != nil {
+		t.Fatalf("error reading manifest file: %s", err)
+	}
+	if i := manifest.FindRelease("v0.1.1"); i == -1 || !manifest.Releases[i].Draft {
+		t.Error("the draft release wasn't rebuilt from the backup")
+	}
+	if latest := readLatestLink(dname, latestLinkName); latest != "v0.1.0" {
+		t.Errorf("the latest link isn't correctly linked: %s", latest)
+	}
+
+	// IDs of releases in the trash aren't reused.
+	err = runTestApp(now, "--repo", dname, "remove-release", "--yes", "--tag", "v0.1.1")
+	if err != nil {
+		t.Fatalf("error running the app: %s", err)
+	}
+	os.Remove(filepath.Join(dname, manifestFileName))
+	os.Remove(filepath.Join(dname, manifestFileName+backupFileSuffix))
+	err = runTestApp(now, "--repo", dname, "rebuild-manifest")
+	if err != nil {
+		t.Fatalf("error running the app: %s", err)
+	}
+	manifest, err = readManifestFile(filepath.Join(dname, manifestFileName))
+	if err != nil {
+		t.Fatalf("error reading manifest file: %s", err)
+	}
+	if manifest.LastReleaseID != 3 || manifest.LastAssetID != 9 || manifest.Releases[0].ID != 3 {
+		t.Errorf("the rebuilt IDs collide with the trash: %d %d", manifest.LastReleaseID, manifest.LastAssetID)
+	}
+}
+
+// Test release channels.
+func TestChannels(t *testing.T) {
+	dname := t.TempDir()
+	testsDir, _ := filepath.Abs("tests")
+	now, _ := time.Parse(time.DateOnly, "2024-10-08")
+
+	// Add a stable release and two beta releases.
+	args := [][]string{
+		{"--release", filepath.Join(testsDir, "v0.1")},
+		{"--channel", "beta", "--prerelease", "--release", filepath.Join(testsDir, "v0.1.1")},
+		{"--channel", "beta", "--release", filepath.Join(testsDir, "v0.1.2")},
+	}
+	for _, arg := range args {
+		err := runTestApp(now, append([]string{"--repo", dname, "add-release"}, arg...)...)
+		if err != nil {
+			t.Fatalf("error running the app: %s", err)
+		}
+	}
+
+	// Latest stays on stable, while the beta channel has its own latest.
+	if latest := readLatestLink(dname, latestLinkName); latest != "v0.1.0" {
+		t.Errorf("the latest link isn't correctly linked: %s", latest)
+	}
+	if latest := readLatestLink(dname, latestLinkName+"-beta"); latest != "v0.1.2" {
+		t.Errorf("the latest-beta link isn't correctly linked: %s", latest)
+	}
+	view, err := readManifestFile(filepath.Join(dname, channelManifestFileName("beta")))
+	if err != nil {
+		t.Fatalf("error reading channel manifest file: %s", err)
+	}
+	if len(view.Releases) != 2 {
+		t.Errorf("the beta manifest has %d releases", len(view.Releases))
+	}
+
+	// Prune only the beta channel.
+	err = runTestApp(now, "--repo", dname, "prune", "--channel", "beta", "--max-releases", "1")
+	if err != nil {
+		t.Errorf("error running the app: %s", err)
+	}
+	if _, serr := os.Stat(filepath.Join(dname, "v0.1.0")); serr != nil {
+		t.Error("v0.1.0 does not exist, when it should.")
+	}
+	if _, serr := os.Stat(filepath.Join(dname, "v0.1.1")); !os.IsNotExist(serr) {
+		t.Error("v0.1.1 exists, when it shouldn't exist.")
+	}
+
+	// Invalid channel names should be rejected.
+	if validateChannel("../beta") == nil {
+		t.Error("an invalid channel name was accepted")
+	}
+
+	// The repo should still verify with the channel files.
+	err = runTestApp(now, "--repo", dname, "verify")
+	if err != nil {
+		t.Errorf("error verifying the repo: %s", err)
+	}
+}
+
+// Test deduplicating artifacts in the blob store.
+func TestDedupe(t *testing.T) {
+	dname := t.TempDir()
+	testsDir, _ := filepath.Abs("tests")
+	now, _ := time.Parse(time.DateOnly, "2024-10-08")
+
+	// Add releases with the same archive.
+	for _, release := range []string{"v0.1", "v0.1.1", "v0.1.2"} {
+		err := runTestApp(now, "--repo", dname, "add-release", "--dedupe", "--release", filepath.Join(testsDir, release))
+		if err != nil {
+			t.Fatalf("error running the app: %s", err)
+		}
+	}
+
+	// The archives should be the same file.
+	a, err := os.Stat(filepath.Join(dname, "v0.1.1/example_linux_amd64.tar.gz"))
+	if err != nil {
+		t.Fatalf("error reading asset: %s", err)
+	}
+	b, err := os.Stat(filepath.Join(dname, "v0.1.2/example_linux_amd64.tar.gz"))
+	if err != nil {
+		t.Fatalf("error reading asset: %s", err)
+	}
+	if !os.SameFile(a, b) {
+		t.Error("the archives were not deduplicated")
+	}
+	blob, _ := blobPath(dname, "sha256:9208c58af1265438c6894499847355bd5e77f93d04b201393baf41297d4680a3")
+
+	// A dry run shouldn't report blobs the trash would still reference.
+	var logged bytes.Buffer
+	log.SetOutput(&logged)
+	err = runTestApp(now, "--repo", dname, "prune", "--max-releases", "1", "--dry-run")
+	log.SetOutput(os.Stderr)
+	if err != nil {
+		t.Errorf("error running the app: %s", err)
+	}
+	if strings.Contains(logged.String(), "unreferenced blob") {
+		t.Errorf("a dry run reported removing referenced blobs:\n%s", logged.String())
+	}
+
+	// Pruning some releases should keep the shared blob.
+	err = runTestApp(now, "--repo", dname, "prune", "--max-releases", "1")
+	if err != nil {
+		t.Errorf("error running the app: %s", err)
+	}
+	if _, serr := os.Stat(blob); serr != nil {
+		t.Error("the blob was removed while still referenced")
+	}
+
+	// Removing the last release should keep the blob while it's in the trash.
+	err = runTestApp(now, "--repo", dname, "remove-release", "--yes", "--tag", "v0.1.2")
+	if err != nil {
+		t.Errorf("error running the app: %s", err)
+	}
+	if _, serr := os.Stat(blob); serr != nil {
+		t.Error("the blob was removed while referenced by the trash")
+	}
+
+	// Emptying the trash should remove the blob.
+	err = runTestApp(now, "--repo", dname, "empty-trash")
+	if err != nil {
+		t.Errorf("error running the app: %s", err)
+	}
+	if _, serr := os.Stat(blob); !os.IsNotExist(serr) {
+		t.Error("the blob wasn't removed once unreferenced")
+	}
+
+	// Hard linking from dist shouldn't change the dist files or share them with the blob store.
+	release := copyTestRelease(t, "v0.1")
+	artifact := filepath.Join(release, "example_linux_amd64.tar.gz")
+	before, _ := os.Stat(artifact)
+	err = runTestApp(now, "--repo", dname, "add-release", "--dedupe", "--link-mode", "hardlink", "--release", release)
+	if err != nil {
+		t.Fatalf("error running the app: %s", err)
+	}
+	a, err = os.Stat(artifact)
+	if err != nil {
+		t.Fatalf("error reading artifact: %s", err)
+	}
+	b, err = os.Stat(blob)
+	if err != nil {
+		t.Fatalf("error reading blob: %s", err)
+	}
+	if a.Mode() != before.Mode() {
+		t.Errorf("the dist artifact mode changed from %s to %s", before.Mode(), a.Mode())
+	}
+	if os.SameFile(a, b) {
+		t.Error("the blob shares its file with the dist artifact")
+	}
+}
+
+// Test placing artifacts with link modes.
+func TestLinkMode(t *testing.T) {
+	dname := t.TempDir()
+	now, _ := time.Parse(time.DateOnly, "2024-10-08")
+
+	// Hard link a release.
+	release := copyTestRelease(t, "v0.1")
+	err := runTestApp(now, "--repo", dname, "add-release", "--link-mode", "hardlink", "--release", release)
+	if err != nil {
+		t.Fatalf("error running the app: %s", err)
+	}
+	a, _ := os.Stat(filepath.Join(release, "example_linux_amd64.tar.gz"))
+	b, err := os.Stat(filepath.Join(dname, "v0.1.0/example_linux_amd64.tar.gz"))
+	if err != nil {
+		t.Fatalf("error reading asset: %s", err)
+	}
+	if !os.SameFile(a, b) {
+		t.Error("the archive was not hard linked")
+	}
+
+	// A failed move should leave the artifacts in dist.
+	release = copyTestRelease(t, "v0.1.1")
+	err = os.WriteFile(filepath.Join(release, "checksums.txt"), []byte("0000000000000000000000000000000000000000000000000000000000000000  example_linux_amd64.tar.gz\n"), 0644)
+	if err != nil {
+		t.Fatalf("error writing checksums file: %s", err)
+	}
+	err = runTestApp(now, "--repo", dname, "add-release", "--link-mode", "move", "--release", release)
+	if err == nil {
+		t.Error("add-release succeeded with a bad checksum")
+	}
+	for _, file := range []string{"example_linux_amd64.tar.gz", "metadata.json", "artifacts.json"} {
+		if _, serr := os.Stat(filepath.Join(release, file)); serr != nil {
+			t.Errorf("%s was removed from dist by a failed move", file)
+		}
+	}
+	if _, serr := os.Stat(filepath.Join(dname, "v0.1.1")); !os.IsNotExist(serr) {
+		t.Error("v0.1.1 exists after a failed add-release.")
+	}
+
+	// Move a release.
+	release = copyTestRelease(t, "v0.1.1")
+	src, _ := os.Stat(filepath.Join(release, "example_linux_amd64.tar.gz"))
+	err = runTestApp(now, "--repo", dname, "add-release", "--link-mode", "move", "--release", release)
+	if err != nil {
+		t.Fatalf("error running the app: %s", err)
+	}
+	if _, serr := os.Stat(filepath.Join(release, "example_linux_amd64.tar.gz")); !os.IsNotExist(serr) {
+		t.Error("the archive was not moved")
+	}
+
+	// Copies should keep the modification time.
+	release = copyTestRelease(t, "v0.1.2")
+	os.Chtimes(filepath.Join(release, "example_linux_amd64.tar.gz"), time.Time{}, src.ModTime().Add(-time.Hour))
+	err = runTestApp(now, "--repo", dname, "add-release", "--release", release)
+	if err != nil {
+		t.Fatalf("error running the app: %s", err)
+	}
+	b, err = os.Stat(filepath.Join(dname, "v0.1.2/example_linux_amd64.tar.gz"))
+	if err != nil {
+		t.Fatalf("error reading asset: %s", err)
+	}
+	if !b.ModTime().Equal(src.ModTime().Add(-time.Hour)) {
+		t.Error("the archive modification time wasn't preserved")
+	}
+}
+
+// Test artifact filters on add-release.
+func TestArtifactFilter(t *testing.T) {
+	dname := t.TempDir()
+	testsDir, _ := filepath.Abs("tests")
+	now, _ := time.Parse(time.DateOnly, "2024-10-08")
+
+	// Only publish archives.
+	err := runTestApp(now, "--repo", dname, "add-release", "--include-type", "archive", "--release", filepath.Join(testsDir, "v0.1"))
+	if err != nil {
+		t.Fatalf("error running the app: %s", err)
+	}
+
+	// Exclude the checksums file, and filter to a platform not built.
+	err = runTestApp(now, "--repo", dname, "add-release", "--exclude", "*.txt", "--goarch", "arm64", "--release", filepath.Join(testsDir, "v0.1.1"))
+	if err != nil {
+		t.Fatalf("error running the app: %s", err)
+	}
+
+	// Confirm the assets published.
+	manifest, err := readManifestFile(filepath.Join(dname, manifestFileName))
+	if err != nil {
+		t.Fatalf("error reading manifest file: %s", err)
+	}
+	var names []string
+	for _, release := range manifest.Releases {
+		for _, asset := range release.Assets {
+			names = append(names, release.TagName+"/"+asset.Name)
+		}
+	}
+	expected := []string{"v0.1.0/example_linux_amd64.tar.gz", "v0.1.1/metadata.json"}
+	if !slices.Equal(names, expected) {
+		t.Errorf("unexpected assets published: %v", names)
+	}
+}
+
+// Test release notes from the changelog, files and templates.
+func TestReleaseNotes(t *testing.T) {
+	dname := t.TempDir()
+	now, _ := time.Parse(time.DateOnly, "2024-10-08")
+
+	// The goreleaser changelog is used when no notes are provided.
+	release := copyTestRelease(t, "v0.1")
+	os.WriteFile(filepath.Join(release, changelogFileName), []byte("## Changelog\n* Fixed things.\n"), 0644)
+	err := runTestApp(now, "--repo", dname, "add-release", "--release", release)
+	if err != nil {
+		t.Fatalf("error running the app: %s", err)
+	}
+
+	// Notes from a file.
+	notesFile := filepath.Join(t.TempDir(), "notes.md")
+	os.WriteFile(notesFile, []byte("Notes from a file.\n"), 0644)
+	err = runTestApp(now, "--repo", dname, "add-release", "--notes-file", notesFile, "--release", filepath.Join("tests", "v0.1.1"))
+	if err != nil {
+		t.Fatalf("error running the app: %s", err)
+	}
+
+	// Notes from a template.
+	templateFile := filepath.Join(t.TempDir(), "notes.tmpl")
+	os.WriteFile(templateFile, []byte("{{ .ProjectName }} {{ .Version }} ({{ .Commit }}): {{ .Notes }}"), 0644)
+	err = runTestApp(now, "--repo", dname, "add-release", "--notes", "Inline notes.", "--notes-template", templateFile, "--release", filepath.Join("tests", "v0.1.2"))
+	if err != nil {
+		t.Fatalf("error running the app: %s", err)
+	}
+
+	// Confirm the notes.
+	manifest, err := readManifestFile(filepath.Join(dname, manifestFileName))
+	if err != nil {
+		t.Fatalf("error reading manifest file: %s", err)
+	}
+	expected := []string{
+		"## Changelog\n* Fixed things.",
+		"Notes from a file.",
+		"example v0.1.2 (94bb85eb32ea07f33d627ce0dee905e29d8d1c96): Inline notes.",
+	}
+	for i, release := range manifest.Releases {
+		if release.ReleaseNotes != expected[i] {
+			t.Errorf("unexpected notes for %s: %q", release.TagName, release.ReleaseNotes)
+		}
+	}
+}
+
+// Test editing a release.
+func TestEditRelease(t *testing.T) {
+	dname := t.TempDir()
+	testsDir, _ := filepath.Abs("tests")
+	now, _ := time.Parse(time.DateOnly, "2024-10-08")
+
+	// Add the test releases.
+	for _, release := range []string{"v0.1", "v0.1.1"} {
+		err := runTestApp(now, "--repo", dname, "add-release", "--release", filepath.Join(testsDir, release))
+		if err != nil {
+			t.Fatalf("error running the app: %s", err)
+		}
+	}
+
+	// Make the newest release a draft.
+	err := runTestApp(now, "--repo", dname, "edit-release", "--tag", "v0.1.1", "--draft")
+	if err != nil {
+		t.Errorf("error running the app: %s", err)
+	}
+	if latest := readLatestLink(dname, latestLinkName); latest != "v0.1.0" {
+		t.Errorf("the latest link isn't correctly linked: %s", latest)
+	}
+
+	// Publish it with new notes and date.
+	err = runTestApp(now, "--repo", dname, "edit-release", "--tag", "v0.1.1", "--no-draft", "--notes", "Fixed notes.", "--published-at", "2024-10-01T00:00:00Z", "--name", "renamed")
+	if err != nil {
+		t.Errorf("error running the app: %s", err)
+	}
+	if latest := readLatestLink(dname, latestLinkName); latest != "v0.1.1" {
+		t.Errorf("the latest link isn't correctly linked: %s", latest)
+	}
+	manifest, err := readManifestFile(filepath.Join(dname, manifestFileName))
+	if err != nil {
+		t.Fatalf("error reading manifest file: %s", err)
+	}
+	release := manifest.Releases[manifest.FindRelease("v0.1.1")]
+	published, _ := time.Parse(time.RFC3339, "2024-10-01T00:00:00Z")
+	if release.Draft || release.ReleaseNotes != "Fixed notes." || release.Name != "renamed" || !release.PublishedAt.Equal(published) {
+		t.Error("v0.1.1 wasn't edited correctly.")
+	}
+	if manifest.LastReleaseID != 2 || manifest.LastAssetID != 6 {
+		t.Error("editing changed the manifest IDs")
+	}
+
+	// Editing without changes should fail.
+	err = runTestApp(now, "--repo", dname, "edit-release", "--tag", "v0.1.1")
+	if err == nil {
+		t.Error("edit-release succeeded without changes")
+	}
+}
+
+func TestPrunePolicy(t *testing.T) {
+	now, _ := time.Parse(time.DateOnly, "2024-10-08")
+	day := 24 * time.Hour
+	releases := []*HttpRelease{
+		{TagName: "v1.0.0", PublishedAt: now.Add(-40 * day)},
+		{TagName: "v1.1.0", PublishedAt: now.Add(-30 * day)},
+		{TagName: "v2.0.0", PublishedAt: now.Add(-20 * day)},
+		{TagName: "v2.1.0-rc.1", PublishedAt: now.Add(-10 * day), Prerelease: true},
+		{TagName: "v2.1.0-rc.2", PublishedAt: now.Add(-day), Prerelease: true},
+	}
+	keptTags := func(policy *PrunePolicy) []string {
+		if err := policy.Validate(); err != nil {
+			t.Fatalf("invalid policy: %s", err)
+		}
+		kept := policy.Keep(releases, now)
+		var tags []string
+		for _, release := range releases {
+			if _, ok := kept[release]; ok {
+				tags = append(tags, release.TagName)
+			}
+		}
+		return tags
+	}
+	zero := 0
+
+	tests := []struct {
+		policy *PrunePolicy
+		want   []string
+	}{
+		{&PrunePolicy{KeepLastStable: 1, KeepWithin: 15 * day}, []string{"v2.0.0", "v2.1.0-rc.1", "v2.1.0-rc.2"}},
+		{&PrunePolicy{KeepPerMajor: 1, MinKeep: &zero}, []string{"v1.1.0", "v2.1.0-rc.2"}},
+		{&PrunePolicy{KeepLastPrerelease: 2, KeepWithin: 5 * day, Mode: "intersection"}, []string{"v2.1.0-rc.2"}},
+		{&PrunePolicy{KeepLastStable: 1, KeepWithin: 5 * day, Mode: "intersection"}, []string{"v2.1.0-rc.2"}},
+		{&PrunePolicy{KeepWithin: time.Hour, MinKeep: &zero}, nil},
+	}
+	for i, test := range tests {
+		if got := keptTags(test.policy); !slices.Equal(got, test.want) {
+			t.Errorf("policy %d kept %v, expected %v", i, got, test.want)
+		}
+	}
+
+	// Policies without rules or with unknown modes are invalid.
+	if (&PrunePolicy{}).Validate() == nil {
+		t.Error("policy without rules was valid")
+	}
+	if (&PrunePolicy{KeepLast: 1, Mode: "any"}).Validate() == nil {
+		t.Error("policy with unknown mode was valid")
+	}
+
+	// Prune a repo with a policy file.
+	dname := t.TempDir()
+	testsDir, _ := filepath.Abs("tests")
+	for _, release := range []string{"v0.1", "v0.1.1", "v0.1.2"} {
+		err := runTestApp(now, "--repo", dname, "add-release", "--release", filepath.Join(testsDir, release))
+		if err != nil {
+			t.Fatalf("error running the app: %s", err)
+		}
+	}
+	policyFile := filepath.Join(t.TempDir(), "policy.yaml")
+	err := os.WriteFile(policyFile, []byte("keep_last: 2\nkeep_within: 24h\nmode: intersection\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = runTestApp(now, "--repo", dname, "prune", "--policy-file", policyFile)
+	if err != nil {
+		t.Fatalf("error running the app: %s", err)
+	}
+	manifest, err := readManifestFile(filepath.Join(dname, manifestFileName))
+	if err != nil {
+		t.Fatalf("error reading manifest file: %s", err)
+	}
+	if len(manifest.Releases) != 1 || manifest.Releases[0].TagName != "v0.1.2" {
+		t.Error("the policy file didn't prune the expected releases")
+	}
+
+	// Flags override the policy file, including the mode.
+	err = runTestApp(now, "--repo", dname, "restore", "--tag", "v0.1.1")
+	if err != nil {
+		t.Fatalf("error running the app: %s", err)
+	}
+	err = runTestApp(now, "--repo", dname, "prune", "--policy-file", policyFile, "--mode", "union")
+	if err != nil {
+		t.Fatalf("error running the app: %s", err)
+	}
+	manifest, err = readManifestFile(filepath.Join(dname, manifestFileName))
+	if err != nil {
+		t.Fatalf("error reading manifest file: %s", err)
+	}
+	if len(manifest.Releases) != 2 {
+		t.Error("--mode didn't override the policy file")
+	}
+}
+
+func TestPinRelease(t *testing.T) {
+	dname := t.TempDir()
+	testsDir, _ := filepath.Abs("tests")
+	now, _ := time.Parse(time.DateOnly, "2024-10-08")
+
+	// Add the test releases.
+	for _, release := range []string{"v0.1", "v0.1.1", "v0.1.2"} {
+		err := runTestApp(now, "--repo", dname, "add-release", "--release", filepath.Join(testsDir, release))
+		if err != nil {
+			t.Fatalf("error running the app: %s", err)
+		}
+	}
+
+	// Pin the oldest release and prune down to one release.
+	err := runTestApp(now, "--repo", dname, "pin", "--tag", "v0.1.0")
+	if err != nil {
+		t.Fatalf("error running the app: %s", err)
+	}
+	err = runTestApp(now, "--repo", dname, "prune", "--max-releases=1")
+	if err != nil {
+		t.Fatalf("error running the app: %s", err)
+	}
+	manifest, err := readManifestFile(filepath.Join(dname, manifestFileName))
+	if err != nil {
+		t.Fatalf("error reading manifest file: %s", err)
+	}
+	if len(manifest.Releases) != 2 || manifest.FindRelease("v0.1.0") == -1 || manifest.FindRelease("v0.1.2") == -1 {
+		t.Error("prune didn't keep the pinned release")
+	}
+	if _, err := os.Stat(filepath.Join(dname, "v0.1.0")); err != nil {
+		t.Error("the pinned release files were removed")
+	}
+
+	// Once unpinned, it can be pruned.
+	err = runTestApp(now, "--repo", dname, "unpin", "--tag", "v0.1.0")
+	if err != nil {
+		t.Fatalf("error running the app: %s", err)
+	}
+	err = runTestApp(now, "--repo", dname, "prune", "--max-releases=1")
+	if err != nil {
+		t.Fatalf("error running the app: %s", err)
+	}
+	manifest, err = readManifestFile(filepath.Join(dname, manifestFileName))
+	if err != nil {
+		t.Fatalf("error reading manifest file: %s", err)
+	}
+	if len(manifest.Releases) != 1 || manifest.Releases[0].TagName != "v0.1.2" {
+		t.Error("prune didn't remove the unpinned release")
+	}
+
+	// Pinning a missing release fails.
+	err = runTestApp(now, "--repo", dname, "pin", "--tag", "v0.1.0")
+	if err == nil {
+		t.Error("pinned a release that doesn't exist")
+	}
+}
+
+func TestTrash(t *testing.T) {
+	dname := t.TempDir()
+	testsDir, _ := filepath.Abs("tests")
+	now, _ := time.Parse(time.DateOnly, "2024-10-08")
+
+	// Add the test releases.
+	for _, release := range []string{"v0.1", "v0.1.1", "v0.1.2"} {
+		err := runTestApp(now, "--repo", dname, "add-release", "--release", filepath.Join(testsDir, release))
+		if err != nil {
+			t.Fatalf("error running the app: %s", err)
+		}
+	}
+	manifestFile := filepath.Join(dname, manifestFileName)
+	original, err := readManifestFile(manifestFile)
+	if err != nil {
+		t.Fatalf("error reading manifest file: %s", err)
+	}
+	originalID := original.Releases[original.FindRelease("v0.1.0")].ID
+
+	// Prune to the newest release, which should move the others to the trash.
+	err = runTestApp(now, "--repo", dname, "prune", "--max-releases=1")
+	if err != nil {
+		t.Fatalf("error running the app: %s", err)
+	}
+	trash, err := readTrash(dname)
+	if err != nil {
+		t.Fatalf("error reading trash: %s", err)
+	}
+	if len(trash) != 1 || len(trash[0].Manifest.Releases) != 2 {
+		t.Fatal("the pruned releases weren't moved to the trash")
+	}
+	if _, err := os.Stat(filepath.Join(trash[0].Path, "v0.1.0", "checksums.txt")); err != nil {
+		t.Error("the pruned release files weren't moved to the trash")
+	}
+
+	// Restore the oldest release with its original ID.
+	err = runTestApp(now, "--repo", dname, "restore", "--tag", "v0.1.0")
+	if err != nil {
+		t.Fatalf("error running the app: %s", err)
+	}
+	manifest, err := readManifestFile(manifestFile)
+	if err != nil {
+		t.Fatalf("error reading manifest file: %s", err)
+	}
+	i := manifest.FindRelease("v0.1.0")
+	if i == -1 || manifest.Releases[i].ID != originalID {
+		t.Error("the release wasn't restored with its original ID")
+	}
+	if _, err := os.Stat(filepath.Join(dname, "v0.1.0", "checksums.txt")); err != nil {
+		t.Error("the release files weren't restored")
+	}
+	if err := runTestApp(now, "--repo", dname, "verify"); err != nil {
+		t.Errorf("the restored repo didn't verify: %s", err)
+	}
+
+	// Restoring a release already in the repo fails.
+	err = runTestApp(now, "--repo", dname, "restore", "--tag", "v0.1.0")
+	if err == nil {
+		t.Error("restored a release which already exists")
+	}
+
+	// Entries newer than the cutoff are kept.
+	err = runTestApp(now.Add(time.Hour), "--repo", dname, "empty-trash", "--older-than=24h")
+	if err != nil {
+		t.Fatalf("error running the app: %s", err)
+	}
+	if trash, _ := readTrash(dname); len(trash) != 1 {
+		t.Error("a trash entry newer than the cutoff was removed")
+	}
+	err = runTestApp(now.Add(48*time.Hour), "--repo", dname, "empty-trash", "--older-than=24h")
+	if err != nil {
+		t.Fatalf("error running the app: %s", err)
+	}
+	if trash, _ := readTrash(dname); len(trash) != 0 {
+		t.Error("a trash entry older than the cutoff wasn't removed")
+	}
+	if err := runTestApp(now, "--repo", dname, "restore", "--tag", "v0.1.1"); err == nil {
+		t.Error("restored a release after emptying the trash")
+	}
+
+	// An entry without a manifest shouldn't break commands using the trash.
+	err = os.MkdirAll(filepath.Join(dname, trashDirName, now.UTC().Format(trashTimeFormat)), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if trash, err := readTrash(dname); err != nil || len(trash) != 0 {
+		t.Error("an unreadable trash entry wasn't skipped")
+	}
+	err = runTestApp(now, "--repo", dname, "remove-release", "--yes", "--tag", "v0.1.0")
+	if err != nil {
+		t.Fatalf("error running the app: %s", err)
+	}
+	if trash, _ := readTrash(dname); len(trash) != 1 || trash[0].Manifest.FindRelease("v0.1.0") == -1 {
+		t.Error("the removed release wasn't moved to a new trash entry")
+	}
+}
+
+func TestGc(t *testing.T) {
+	dname := t.TempDir()
+	testsDir, _ := filepath.Abs("tests")
+	now, _ := time.Parse(time.DateOnly, "2024-10-08")
+
+	// Add a release, skipping the binary.
+	err := runTestApp(now, "--repo", dname, "add-release", "--release", filepath.Join(testsDir, "v0.1"))
+	if err != nil {
+		t.Fatalf("error running the app: %s", err)
+	}
+
+	// Add files the manifest doesn't reference.
+	orphans := []string{"v0.1.0/example_linux_amd64", "stray", ".staging-v0.1.1-123"}
+	for _, orphan := range orphans {
+		err = os.WriteFile(filepath.Join(dname, orphan), []byte("orphan"), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = os.MkdirAll(filepath.Join(dname, "v0.0.9"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	orphans = append(orphans, "v0.0.9")
+
+	// Listing shouldn't delete anything.
+	err = runTestApp(now, "--repo", dname, "gc")
+	if err != nil {
+		t.Fatalf("error running the app: %s", err)
+	}
+	for _, orphan := range orphans {
+		if _, serr := os.Stat(filepath.Join(dname, orphan)); serr != nil {
+			t.Errorf("%s was removed without --delete", orphan)
+		}
+	}
+
+	// Delete the unreferenced files, keeping the repo files.
+	err = runTestApp(now, "--repo", dname, "gc", "--delete", "--yes")
+	if err != nil {
+		t.Fatalf("error running the app: %s", err)
+	}
+	for _, orphan := range orphans {
+		if _, serr := os.Stat(filepath.Join(dname, orphan)); !os.IsNotExist(serr) {
+			t.Errorf("%s wasn't removed", orphan)
+		}
+	}
+	for _, file := range []string{manifestFileName, latestLinkName, "v0.1.0/checksums.txt", "v0.1.0/.goreleaser/metadata.json"} {
+		if _, serr := os.Lstat(filepath.Join(dname, file)); serr != nil {
+			t.Errorf("%s was removed", file)
+		}
+	}
+	if err := runTestApp(now, "--repo", dname, "verify"); err != nil {
+		t.Errorf("the repo didn't verify after gc: %s", err)
+	}
+}
+
+func TestPruneMaxSize(t *testing.T) {
+	// Sizes can be given with units.
+	sizes := map[string]ByteSize{
+		"512":    512,
+		"1.5KiB": 1536,
+		"20GiB":  20 << 30,
+		"20G":    20 << 30,
+		"500MB":  500e6,
+		"2 TiB":  2 << 40,
+	}
+	for s, want := range sizes {
+		if got, err := parseByteSize(s); err != nil || got != want {
+			t.Errorf("parseByteSize(%q) = %d, %v, expected %d", s, got, err, want)
+		}
+	}
+	for _, s := range []string{"", "GiB", "20XB", "1.2.3"} {
+		if _, err := parseByteSize(s); err == nil {
+			t.Errorf("parseByteSize(%q) didn't fail", s)
+		}
+	}
+
+	dname := t.TempDir()
+	testsDir, _ := filepath.Abs("tests")
+	now, _ := time.Parse(time.DateOnly, "2024-10-08")
+
+	// Add the test releases.
+	for _, release := range []string{"v0.1", "v0.1.1", "v0.1.2"} {
+		err := runTestApp(now, "--repo", dname, "add-release", "--release", filepath.Join(testsDir, release))
+		if err != nil {
+			t.Fatalf("error running the app: %s", err)
+		}
+	}
+	manifestFile := filepath.Join(dname, manifestFileName)
+	manifest, err := readManifestFile(manifestFile)
+	if err != nil {
+		t.Fatalf("error reading manifest file: %s", err)
+	}
+	var total int64
+	for _, release := range manifest.Releases {
+		total += release.Size()
+	}
+
+	// The trash counts towards the size, and is emptied before releases are pruned.
+	err = runTestApp(now, "--repo", dname, "remove-release", "--yes", "--tag", "v0.1.0")
+	if err != nil {
+		t.Fatalf("error running the app: %s", err)
+	}
+	err = runTestApp(now, "--repo", dname, "prune", fmt.Sprintf("--max-size=%dB", total-1))
+	if err != nil {
+		t.Fatalf("error running the app: %s", err)
+	}
+	manifest, err = readManifestFile(manifestFile)
+	if err != nil {
+		t.Fatalf("error reading manifest file: %s", err)
+	}
+	if len(manifest.Releases) != 2 {
+		t.Error("prune removed releases when emptying the trash was enough")
+	}
+	if trash, _ := readTrash(dname); len(trash) != 0 {
+		t.Error("prune didn't empty the trash to fit the size")
+	}
+
+	// A size too small for any release keeps the pinned and latest releases.
+	err = runTestApp(now, "--repo", dname, "pin", "--tag", "v0.1.1")
+	if err != nil {
+		t.Fatalf("error running the app: %s", err)
+	}
+	err = runTestApp(now, "--repo", dname, "prune", "--max-size=1")
+	if err != nil {
+		t.Fatalf("error running the app: %s", err)
+	}
+	manifest, err = readManifestFile(manifestFile)
+	if err != nil {
+		t.Fatalf("error reading manifest file: %s", err)
+	}
+	if len(manifest.Releases) != 2 {
+		t.Error("prune removed the pinned or latest release")
+	}
+	err = runTestApp(now, "--repo", dname, "unpin", "--tag", "v0.1.1")
+	if err != nil {
+		t.Fatalf("error running the app: %s", err)
+	}
+	err = runTestApp(now, "--repo", dname, "prune", "--max-size=1")
+	if err != nil {
+		t.Fatalf("error running the app: %s", err)
+	}
+	manifest, err = readManifestFile(manifestFile)
+	if err != nil {
+		t.Fatalf("error reading manifest file: %s", err)
+	}
+	if len(manifest.Releases) != 1 || manifest.Releases[0].TagName != "v0.1.2" {
+		t.Error("prune didn't keep only the latest release")
+	}
+
+	// Releases pruned for size are deleted, rather than kept in the trash.
+	if trash, _ := readTrash(dname); len(trash) != 0 {
+		t.Error("releases pruned for size were moved to the trash")
+	}
+	if _, serr := os.Stat(filepath.Join(dname, "v0.1.1")); !os.IsNotExist(serr) {
+		t.Error("v0.1.1 exists after pruning for size")
+	}
+
+	// Releases other rules prune still go to the trash when the repo fits.
+	dname = t.TempDir()
+	manifestFile = filepath.Join(dname, manifestFileName)
+	for _, release := range []string{"v0.1", "v0.1.1", "v0.1.2"} {
+		err := runTestApp(now, "--repo", dname, "add-release", "--release", filepath.Join(testsDir, release))
+		if err != nil {
+			t.Fatalf("error running the app: %s", err)
+		}
+	}
+	err = runTestApp(now, "--repo", dname, "prune", "--max-releases=1", "--max-size=1TB")
+	if err != nil {
+		t.Fatalf("error running the app: %s", err)
+	}
+	trash, _ := readTrash(dname)
+	if len(trash) != 1 || len(trash[0].Manifest.Releases) != 2 {
+		t.Fatal("releases pruned by other rules weren't moved to the trash")
+	}
+
+	// When the trash doesn't fit, the oldest pruned releases are deleted instead of trashed.
+	err = runTestApp(now, "--repo", dname, "restore", "--tag", "v0.1.0")
+	if err == nil {
+		err = runTestApp(now, "--repo", dname, "restore", "--tag", "v0.1.1")
+	}
+	if err != nil {
+		t.Fatalf("error running the app: %s", err)
+	}
+	err = runTestApp(now, "--repo", dname, "prune", "--max-releases=1", fmt.Sprintf("--max-size=%dB", total-1))
+	if err != nil {
+		t.Fatalf("error running the app: %s", err)
+	}
+	manifest, err = readManifestFile(manifestFile)
+	if err != nil {
+		t.Fatalf("error reading manifest file: %s", err)
+	}
+	if len(manifest.Releases) != 1 || manifest.Releases[0].TagName != "v0.1.2" {
+		t.Error("prune didn't keep only the newest release")
+	}
+	trash, _ = readTrash(dname)
+	if len(trash) != 1 || len(trash[0].Manifest.Releases) != 1 || trash[0].Manifest.Releases[0].TagName != "v0.1.1" {
+		t.Error("only v0.1.1 should be in the trash")
+	}
+	if _, serr := os.Stat(filepath.Join(dname, "v0.1.0")); !os.IsNotExist(serr) {
+		t.Error("v0.1.0 exists after pruning for size")
+	}
+}
+
+func TestRepoLock(t *testing.T) {
+	dname := t.TempDir()
+
+	// Take the lock, recording this process as the holder.
+	lock, err := lockRepo(dname)
+	if err != nil {
+		t.Fatalf("error locking the repo: %s", err)
+	}
+	info, err := readLockInfo(filepath.Join(dname, lockFileName))
+	if err != nil || info.PID != os.Getpid() {
+		t.Errorf("the lock holder wasn't recorded: %v", err)
+	}
+
+	// A second lock should wait until the first is released.
+	locked := make(chan *RepoLock)
+	go func() {
+		second, err := lockRepo(dname)
+		if err != nil {
+			t.Errorf("error locking the repo: %s", err)
+		}
+		locked <- second
+	}()
+	select {
+	case <-locked:
+		t.Fatal("the repo was locked twice")
+	case <-time.After(100 * time.Millisecond):
+	}
+	lock.Unlock()
+	select {
+	case second := <-locked:
+		second.Unlock()
+	case <-time.After(5 * time.Second):
+		t.Fatal("the lock wasn't released")
+	}
+
+	// Locks are stale once the holder is gone, or are too old.
+	now := time.Now()
+	running := func(int) bool { return true }
+	gone := func(int) bool { return false }
+	if (&lockInfo{PID: 1, Locked: now}).stale(now, running) {
+		t.Error("a lock held by a running process is stale")
+	}
+	if !(&lockInfo{PID: 1, Locked: now}).stale(now, gone) {
+		t.Error("a lock held by a process which is gone isn't stale")
+	}
+	if !(&lockInfo{PID: 1, Locked: now.Add(-2 * staleLockAge)}).stale(now, running) {
+		t.Error("an abandoned lock isn't stale")
+	}
+}
+
+func TestAtomicWrite(t *testing.T) {
+	dname := t.TempDir()
+	app = new(App)
+
+	// Atomic writes shouldn't leave temp files behind.
+	path := filepath.Join(dname, "file")
+	err := writeFileAtomic(path, []byte("data"), 0600)
+	if err != nil {
+		t.Fatalf("error writing file: %s", err)
+	}
+	stat, err := os.Stat(path)
+	if err != nil || stat.Mode().Perm() != 0600 {
+		t.Error("the file wasn't written with the right permissions")
+	}
+	if data, _ := os.ReadFile(path); string(data) != "data" {
+		t.Error("the file data isn't correct")
+	}
+
+	// Writing the manifest should keep the previous one as a backup.
+	manifestFile := filepath.Join(dname, manifestFileName)
+	for id := range int64(2) {
+		err = writeManifestFile(manifestFile, &HttpManifest{LastReleaseID: id + 1})
+		if err != nil {
+			t.Fatalf("error writing manifest: %s", err)
+		}
+	}
+	manifest, err := readManifestFile(manifestFile)
+	if err != nil || manifest.LastReleaseID != 2 {
+		t.Error("the manifest wasn't written")
+	}
+	backup, err := readManifestFile(manifestFile + backupFileSuffix)
+	if err != nil || backup.LastReleaseID != 1 {
+		t.Error("the previous manifest wasn't kept as a backup")
+	}
+
+	// Only the files written should be in the directory.
+	entries, _ := os.ReadDir(dname)
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	if !slices.Equal(names, []string{"file", manifestFileName, manifestFileName + backupFileSuffix}) {
+		t.Errorf("temp files were left behind: %v", names)
+	}
+}
+
+// Capture what a function writes to stdout.
+func captureStdout(t *testing.T, fn func() error) (string, error) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	done := make(chan []byte)
+	go func() {
+		data, _ := io.ReadAll(r)
+		done <- data
+	}()
+	err = fn()
+	w.Close()
+	os.Stdout = stdout
+	return string(<-done), err
+}
+
+func TestListShow(t *testing.T) {
+	dname := t.TempDir()
+	testsDir, _ := filepath.Abs("tests")
+	now, _ := time.Parse(time.DateOnly, "2024-10-08")
+
+	// Add the test releases.
+	for _, release := range []string{"v0.1", "v0.1.1", "v0.1.2"} {
+		err := runTestApp(now, "--repo", dname, "add-release", "--release", filepath.Join(testsDir, release))
+		if err != nil {
+			t.Fatalf("error running the app: %s", err)
+		}
+	}
+	manifest, err := readManifestFile(filepath.Join(dname, manifestFileName))
+	if err != nil {
+		t.Fatalf("error reading manifest file: %s", err)
+	}
+
+	// List the releases as JSON.
+	out, err := captureStdout(t, func() error {
+		return runTestApp(now, "--repo", dname, "list", "-o", "json")
+	})
+	if err != nil {
+		t.Fatalf("error running the app: %s", err)
+	}
+	var summaries []*ReleaseSummary
+	err = json.Unmarshal([]byte(out), &summaries)
+	if err != nil {
+		t.Fatalf("error parsing list output: %s", err)
+	}
+	if len(summaries) != 3 {
+		t.Fatalf("expected 3 releases, got %d", len(summaries))
+	}
+	for i, summary := range summaries {
+		release := manifest.Releases[i]
+		if summary.TagName != release.TagName || summary.Assets != len(release.Assets) || summary.Size != release.Size() {
+			t.Errorf("the summary of %s doesn't match the manifest", release.TagName)
+		}
+		if summary.Latest != (summary.TagName == "v0.1.2") {
+			t.Errorf("the latest flag of %s is wrong", summary.TagName)
+		}
+	}
+
+	// Show a release as JSON.
+	out, err = captureStdout(t, func() error {
+		return runTestApp(now, "--repo", dname, "show", "v0.1.1", "-o", "json")
+	})
+	if err != nil {
+		t.Fatalf("error running the app: %s", err)
+	}
+	var release *HttpRelease
+	err = json.Unmarshal([]byte(out), &release)
+	if err != nil {
+		t.Fatalf("error parsing show output: %s", err)
+	}
+	if release.TagName != "v0.1.1" || len(release.Assets) != 3 {
+		t.Error("show didn't output the release")
+	}
+
+	// Showing a missing release fails.
+	err = runTestApp(now, "--repo", dname, "show", "v9.9.9")
+	if err == nil {
+		t.Error("show succeeded for a missing release")
+	}
+}
+
+func TestRunJobs(t *testing.T) {
+	// All jobs run when none fail.
+	var ran atomic.Int32
+	err := runJobs(10, 3, func(i int) error {
+		ran.Add(1)
+		return nil
+	})
+	if err != nil || ran.Load() != 10 {
+		t.Errorf("expected 10 jobs to run without error, %d ran: %v", ran.Load(), err)
+	}
+
+	// The first error in job order is returned, even if a later job fails first.
+	errFirst := errors.New("first")
+	errLater := errors.New("later")
+	started := make(chan bool)
+	err = runJobs(2, 2, func(i int) error {
+		if i == 0 {
+			<-started
+			return errFirst
+		}
+		defer close(started)
+		return errLater
+	})
+	if err != errFirst {
+		t.Errorf("expected the first error in job order, got: %v", err)
+	}
+
+	// Jobs queued after a failure are skipped.
+	ran.Store(0)
+	err = runJobs(100, 1, func(i int) error {
+		ran.Add(1)
+		if i == 2 {
+			return errFirst
+		}
+		return nil
+	})
+	if err != errFirst || ran.Load() != 3 {
+		t.Errorf("expected jobs after the failure to be skipped, %d ran: %v", ran.Load(), err)
+	}
+
+	// Adding a release requires at least one job.
+	if (&AddReleaseCmd{Jobs: 0}).AfterApply() == nil {
+		t.Error("zero jobs was accepted")
+	}
+	if (&AddReleaseCmd{Jobs: 1}).AfterApply() != nil {
+		t.Error("one job wasn't accepted")
+	}
+}
@@ -1,39 +1,111 @@
 package main
 
 import (
+	"bytes"
+	"log"
 	"os"
+	"path/filepath"
+	"slices"
 	"time"
 
 	"gopkg.in/yaml.v3"
 )
 
+const (
+	manifestFileName = "manifest.yaml"
+	backupFileSuffix = ".bak"
+	lockFileName     = ".lock"
+)
+
 // An individual asset.
+// Fields past the URL are extras for tooling, go-selfupdate ignores them.
 type HttpAsset struct {
-	ID   int64  `yaml:"id"`
-	Name string `yaml:"name"`
-	Size int    `yaml:"size"`
-	URL  string `yaml:"url"`
+	ID       int64  `yaml:"id" json:"id"`
+	Name     string `yaml:"name" json:"name"`
+	Size     int    `yaml:"size" json:"size"`
+	URL      string `yaml:"url" json:"url"`
+	Type     string `yaml:"type,omitempty" json:"type,omitempty"`
+	Goos     string `yaml:"goos,omitempty" json:"goos,omitempty"`
+	Goarch   string `yaml:"goarch,omitempty" json:"goarch,omitempty"`
+	Goarm    string `yaml:"goarm,omitempty" json:"goarm,omitempty"`
+	Goamd64  string `yaml:"goamd64,omitempty" json:"goamd64,omitempty"`
+	Checksum string `yaml:"checksum,omitempty" json:"checksum,omitempty"`
 }
 
 // An individual release.
 type HttpRelease struct {
-	ID           int64        `yaml:"id"`
-	ReleaseID    int64        `yaml:"release_id"`
-	Name         string       `yaml:"name"`
-	TagName      string       `yaml:"tag_name"`
-	URL          string       `yaml:"url"`
-	Draft        bool         `yaml:"draft"`
-	Prerelease   bool         `yaml:"prerelease"`
-	PublishedAt  time.Time    `yaml:"published_at"`
-	ReleaseNotes string       `yaml:"release_notes"`
-	Assets       []*HttpAsset `yaml:"assets"`
+	ID           int64        `yaml:"id" json:"id"`
+	ReleaseID    int64        `yaml:"release_id" json:"release_id"`
+	Name         string       `yaml:"name" json:"name"`
+	TagName      string       `yaml:"tag_name" json:"tag_name"`
+	URL          string       `yaml:"url" json:"url"`
+	Draft        bool         `yaml:"draft" json:"draft"`
+	Prerelease   bool         `yaml:"prerelease" json:"prerelease"`
+	PublishedAt  time.Time    `yaml:"published_at" json:"published_at"`
+	ReleaseNotes string       `yaml:"release_notes" json:"release_notes"`
+	Assets       []*HttpAsset `yaml:"assets" json:"assets"`
+	Tag          string       `yaml:"tag,omitempty" json:"tag,omitempty"`
+	PreviousTag  string       `yaml:"previous_tag,omitempty" json:"previous_tag,omitempty"`
+	Commit       string       `yaml:"commit,omitempty" json:"commit,omitempty"`
+	Channel      string       `yaml:"channel,omitempty" json:"channel,omitempty"`
+	Pinned       bool         `yaml:"pinned,omitempty" json:"pinned,omitempty"`
+}
+
+// The total size of the assets in the release.
+func (r *HttpRelease) Size() int64 {
+	var size int64
+	for _, asset := range r.Assets {
+		size += int64(asset.Size)
+	}
+	return size
 }
 
 // The manifest file structure.
 type HttpManifest struct {
-	LastReleaseID int64          `yaml:"last_release_id"`
-	LastAssetID   int64          `yaml:"last_asset_id"`
-	Releases      []*HttpRelease `yaml:"releases"`
+	LastReleaseID int64          `yaml:"last_release_id" json:"last_release_id"`
+	LastAssetID   int64          `yaml:"last_asset_id" json:"last_asset_id"`
+	Releases      []*HttpRelease `yaml:"releases" json:"releases"`
+}
+
+// Find the index of a release by its tag, -1 if it isn't in the manifest.
+func (m *HttpManifest) FindRelease(tag string) int {
+	for i, release := range m.Releases {
+		if release.TagName == tag {
+			return i
+		}
+	}
+	return -1
+}
+
+// The channels releases are in, sorted by name.
+func (m *HttpManifest) Channels() []string {
+	var channels []string
+	for _, release := range m.Releases {
+		if release.Channel != "" && !slices.Contains(channels, release.Channel) {
+			channels = append(channels, release.Channel)
+		}
+	}
+	slices.Sort(channels)
+	return channels
+}
+
+// A copy of the manifest with only the releases in a channel.
+func (m *HttpManifest) ChannelView(channel string) *HttpManifest {
+	view := &HttpManifest{
+		LastReleaseID: m.LastReleaseID,
+		LastAssetID:   m.LastAssetID,
+	}
+	for _, release := range m.Releases {
+		if release.Channel == channel {
+			view.Releases = append(view.Releases, release)
+		}
+	}
+	return view
+}
+
+// Sort the releases from the oldest to the newest version.
+func (m *HttpManifest) Sort() {
+	slices.SortStableFunc(m.Releases, compareReleases)
 }
 
 // Read and parse manifest file.
@@ -52,21 +124,93 @@ func readManifestFile(manifestFile string) (*HttpManifest, error) {
 	err = decoder.Decode(manifest)
 	yamlFile.Close()
 
+	// Older manifests were kept in the order releases were added.
+	manifest.Sort()
+
 	// Return the manifest and if any error occurred.
 	return manifest, err
 }
 
 // Write manifest file.
+// The manifest is written to a temp file and renamed into place so readers never
+// see a partial manifest, and the previous manifest is kept as a backup.
 func writeManifestFile(manifestFile string, manifest *HttpManifest) error {
-	// Open the file for write.
-	yamlFile, err := os.OpenFile(manifestFile, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	return writeManifest(manifestFile, manifest, true)
+}
+
+// Write a manifest derived from the main manifest, which doesn't need a backup.
+func writeManifestView(manifestFile string, manifest *HttpManifest) error {
+	return writeManifest(manifestFile, manifest, false)
+}
+
+// Write a manifest atomically, optionally keeping a backup, and sign it if signing.
+func writeManifest(manifestFile string, manifest *HttpManifest, backup bool) error {
+	// Open a temp file next to the manifest so the rename stays on one filesystem.
+	dir := filepath.Dir(manifestFile)
+	yamlFile, err := os.CreateTemp(dir, ".manifest-*.yaml")
 	if err != nil {
 		return err
 	}
-	defer yamlFile.Close()
+	tmpFile := yamlFile.Name()
 
-	// Encode data.
-	encoder := yaml.NewEncoder(yamlFile)
+	// Encode data, and ensure it is fully written to disk.
+	var data bytes.Buffer
+	encoder := yaml.NewEncoder(&data)
 	err = encoder.Encode(manifest)
-	return err
+	if err == nil {
+		err = encoder.Close()
+	}
+	if err == nil {
+		_, err = yamlFile.Write(data.Bytes())
+	}
+	if err == nil {
+		err = yamlFile.Sync()
+	}
+	if err == nil {
+		err = yamlFile.Chmod(0644)
+	}
+	yamlFile.Close()
+	if err != nil {
+		os.Remove(tmpFile)
+		return err
+	}
+
+	// Keep the previous manifest as a backup.
+	// A hard link keeps the old data once the new manifest is renamed over it.
+	if _, serr := os.Stat(manifestFile); serr == nil && backup {
+		backupFile := manifestFile + backupFileSuffix
+		os.Remove(backupFile)
+		if lerr := os.Link(manifestFile, backupFile); lerr != nil {
+			err = copyFile(manifestFile, backupFile)
+			if err != nil {
+				os.Remove(tmpFile)
+				return err
+			}
+		}
+	}
+
+	// Move the new manifest into place.
+	err = os.Rename(tmpFile, manifestFile)
+	if err != nil {
+		os.Remove(tmpFile)
+		return err
+	}
+
+	// If signing, sign the manifest data we wrote.
+	if app.signer != nil {
+		sig, serr := signData(app.signer, data.Bytes())
+		if serr != nil {
+			return serr
+		}
+		err = writeFileAtomic(manifestFile+signatureSuffix, sig, 0644)
+		if err != nil {
+			return err
+		}
+	} else if rerr := os.Remove(manifestFile + signatureSuffix); rerr == nil {
+		// A signature left from a signed write no longer matches, so clients would reject it.
+		log.Println("Removed the stale signature of", filepath.Base(manifestFile), "as no signing key was provided.")
+	}
+
+	// Sync the directory so the rename survives a crash.
+	return syncDir(dir)
 }
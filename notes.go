@@ -0,0 +1,47 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// The changelog file goreleaser writes to the dist folder.
+const changelogFileName = "CHANGELOG.md"
+
+// Data available to release notes templates.
+type NotesData struct {
+	ProjectName string
+	Version     string
+	Tag         string
+	PreviousTag string
+	Commit      string
+	Date        time.Time
+	Notes       string
+	Changelog   string
+}
+
+// Read release notes from a file, trimming surrounding whitespace.
+func readNotesFile(notesFile string) (string, error) {
+	data, err := os.ReadFile(notesFile)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// Render release notes from a template file.
+func renderNotesTemplate(templateFile string, data *NotesData) (string, error) {
+	tmpl, err := template.ParseFiles(templateFile)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	err = tmpl.Execute(&buf, data)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(buf.String()), nil
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"log"
+)
+
+type PinCmd struct {
+	Tag string `help:"Tag of the release to pin." required:""`
+}
+
+// Pins a release so prune never removes it.
+func (a *PinCmd) Run() error {
+	return setReleasePinned(a.Tag, true)
+}
+
+type UnpinCmd struct {
+	Tag string `help:"Tag of the release to unpin." required:""`
+}
+
+// Unpins a release so prune may remove it.
+func (a *UnpinCmd) Run() error {
+	return setReleasePinned(a.Tag, false)
+}
+
+// Change the pinned state of a release.
+func setReleasePinned(tag string, pinned bool) error {
+	unchanged := false
+	err := modifyRelease(tag, func(release *HttpRelease) error {
+		unchanged = release.Pinned == pinned
+		release.Pinned = pinned
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if unchanged {
+		log.Printf("Release %s is already pinned=%t", tag, pinned)
+	} else {
+		log.Printf("Release %s is now pinned=%t", tag, pinned)
+	}
+
+	return nil
+}
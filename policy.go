@@ -0,0 +1,235 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Rules for which releases prune keeps, releases no rule keeps are pruned.
+// A maximum size then prunes the oldest kept releases until the repo fits.
+type PrunePolicy struct {
+	KeepLast           int           `yaml:"keep_last"`
+	KeepLastStable     int           `yaml:"keep_last_stable"`
+	KeepLastPrerelease int           `yaml:"keep_last_prerelease"`
+	KeepWithin         time.Duration `yaml:"keep_within"`
+	KeepPerMajor       int           `yaml:"keep_per_major"`
+	KeepPerMinor       int           `yaml:"keep_per_minor"`
+	KeepPerChannel     int           `yaml:"keep_per_channel"`
+	MaxSize            ByteSize      `yaml:"max_size"`
+	MinKeep            *int          `yaml:"min_keep"`
+	Mode               string        `yaml:"mode"`
+}
+
+// The minimum number of releases kept when not set, so a repo is never emptied.
+const defaultMinKeep = 1
+
+// Read and parse a policy file.
+func readPolicyFile(policyFile string) (*PrunePolicy, error) {
+	// Read file, if error return the error.
+	yamlFile, err := os.Open(policyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	// Attempt to decode the file.
+	policy := new(PrunePolicy)
+	decoder := yaml.NewDecoder(yamlFile)
+	decoder.KnownFields(true)
+	err = decoder.Decode(policy)
+	yamlFile.Close()
+
+	// Return the policy and if any error occurred.
+	return policy, err
+}
+
+// Confirm the policy has rules and valid options.
+func (p *PrunePolicy) Validate() error {
+	if p.KeepLast < 0 || p.KeepLastStable < 0 || p.KeepLastPrerelease < 0 || p.KeepWithin < 0 ||
+		p.KeepPerMajor < 0 || p.KeepPerMinor < 0 || p.KeepPerChannel < 0 || p.MaxSize < 0 || (p.MinKeep != nil && *p.MinKeep < 0) {
+		return errors.New("prune policy values must not be negative")
+	}
+	if p.Mode != "" && p.Mode != "union" && p.Mode != "intersection" {
+		return fmt.Errorf("unknown prune policy mode: %s", p.Mode)
+	}
+	if len(p.rules()) == 0 && p.MaxSize == 0 {
+		return errors.New("must provide a prune policy rule or maximum size")
+	}
+	return nil
+}
+
+// A rule deciding which releases to keep.
+type pruneRule struct {
+	name string
+	keep func(releases []*HttpRelease, now time.Time) map[*HttpRelease]bool
+}
+
+// The rules which are set in the policy.
+func (p *PrunePolicy) rules() []*pruneRule {
+	var rules []*pruneRule
+	if p.KeepLast > 0 {
+		rules = append(rules, &pruneRule{"keep-last", func(releases []*HttpRelease, _ time.Time) map[*HttpRelease]bool {
+			return keepNewest(releases, p.KeepLast, nil)
+		}})
+	}
+	if p.KeepLastStable > 0 {
+		rules = append(rules, &pruneRule{"keep-last-stable", func(releases []*HttpRelease, _ time.Time) map[*HttpRelease]bool {
+			return keepNewest(releases, p.KeepLastStable, isStableRelease)
+		}})
+	}
+	if p.KeepLastPrerelease > 0 {
+		rules = append(rules, &pruneRule{"keep-last-prerelease", func(releases []*HttpRelease, _ time.Time) map[*HttpRelease]bool {
+			return keepNewest(releases, p.KeepLastPrerelease, func(release *HttpRelease) bool {
+				return !release.Draft && !isStableRelease(release)
+			})
+		}})
+	}
+	if p.KeepWithin > 0 {
+		rules = append(rules, &pruneRule{"keep-within", func(releases []*HttpRelease, now time.Time) map[*HttpRelease]bool {
+			keep := make(map[*HttpRelease]bool)
+			for _, release := range releases {
+				if now.Sub(release.PublishedAt) < p.KeepWithin {
+					keep[release] = true
+				}
+			}
+			return keep
+		}})
+	}
+	if p.KeepPerMajor > 0 {
+		rules = append(rules, &pruneRule{"keep-per-major", func(releases []*HttpRelease, _ time.Time) map[*HttpRelease]bool {
+			return keepNewestPerGroup(releases, p.KeepPerMajor, func(release *HttpRelease) (string, bool) {
+				v, err := parseVersion(release.TagName)
+				if err != nil {
+					return "", false
+				}
+				return fmt.Sprintf("%d", v.Major), true
+			})
+		}})
+	}
+	if p.KeepPerMinor > 0 {
+		rules = append(rules, &pruneRule{"keep-per-minor", func(releases []*HttpRelease, _ time.Time) map[*HttpRelease]bool {
+			return keepNewestPerGroup(releases, p.KeepPerMinor, func(release *HttpRelease) (string, bool) {
+				v, err := parseVersion(release.TagName)
+				if err != nil {
+					return "", false
+				}
+				return fmt.Sprintf("%d.%d", v.Major, v.Minor), true
+			})
+		}})
+	}
+	if p.KeepPerChannel > 0 {
+		rules = append(rules, &pruneRule{"keep-per-channel", func(releases []*HttpRelease, _ time.Time) map[*HttpRelease]bool {
+			return keepNewestPerGroup(releases, p.KeepPerChannel, func(release *HttpRelease) (string, bool) {
+				return release.Channel, true
+			})
+		}})
+	}
+	return rules
+}
+
+// Decide which releases to keep, with the reasons each is kept.
+// Releases must be sorted from oldest to newest.
+func (p *PrunePolicy) Keep(releases []*HttpRelease, now time.Time) map[*HttpRelease][]string {
+	rules := p.rules()
+	kept := make(map[*HttpRelease][]string)
+
+	// With only a maximum size, every release is kept until the size is applied.
+	if len(rules) == 0 {
+		for _, release := range releases {
+			kept[release] = []string{"max-size"}
+		}
+		return kept
+	}
+	counts := make(map[*HttpRelease]int)
+	for _, rule := range rules {
+		for release := range rule.keep(releases, now) {
+			kept[release] = append(kept[release], rule.name)
+			counts[release]++
+		}
+	}
+
+	// With intersection, every rule must keep the release.
+	if p.Mode == "intersection" {
+		for release, count := range counts {
+			if count != len(rules) {
+				delete(kept, release)
+			}
+		}
+	}
+
+	// Keep the newest releases to meet the minimum.
+	for i := len(releases) - 1; i >= 0 && len(kept) < p.minKeep(); i-- {
+		if _, ok := kept[releases[i]]; !ok {
+			kept[releases[i]] = []string{"min-keep"}
+		}
+	}
+	return kept
+}
+
+// Drop the oldest kept releases until the total size fits in the maximum size, returning those dropped.
+// Protected releases are never dropped, nor are releases needed for the minimum.
+func (p *PrunePolicy) FitSize(releases []*HttpRelease, kept map[*HttpRelease][]string, total int64, protected func(*HttpRelease) bool) map[*HttpRelease]bool {
+	dropped := make(map[*HttpRelease]bool)
+	if p.MaxSize == 0 {
+		return dropped
+	}
+	for _, release := range releases {
+		if total <= int64(p.MaxSize) || len(kept) <= max(p.minKeep(), defaultMinKeep) {
+			break
+		}
+		if _, ok := kept[release]; !ok || protected(release) {
+			continue
+		}
+		delete(kept, release)
+		dropped[release] = true
+		total -= release.Size()
+	}
+	return dropped
+}
+
+// The minimum number of releases to keep.
+func (p *PrunePolicy) minKeep() int {
+	if p.MinKeep != nil {
+		return *p.MinKeep
+	}
+	return defaultMinKeep
+}
+
+// Is this a stable release, published and not a prerelease by flag or version?
+func isStableRelease(release *HttpRelease) bool {
+	if release.Draft || release.Prerelease {
+		return false
+	}
+	v, err := parseVersion(release.TagName)
+	return err != nil || !v.IsPrerelease()
+}
+
+// Keep the newest releases matching a filter.
+func keepNewest(releases []*HttpRelease, n int, filter func(*HttpRelease) bool) map[*HttpRelease]bool {
+	keep := make(map[*HttpRelease]bool)
+	for i := len(releases) - 1; i >= 0 && len(keep) < n; i-- {
+		if filter == nil || filter(releases[i]) {
+			keep[releases[i]] = true
+		}
+	}
+	return keep
+}
+
+// Keep the newest releases in each group.
+func keepNewestPerGroup(releases []*HttpRelease, n int, group func(*HttpRelease) (string, bool)) map[*HttpRelease]bool {
+	keep := make(map[*HttpRelease]bool)
+	counts := make(map[string]int)
+	for _, release := range slices.Backward(releases) {
+		g, ok := group(release)
+		if !ok || counts[g] >= n {
+			continue
+		}
+		counts[g]++
+		keep[release] = true
+	}
+	return keep
+}
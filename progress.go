@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// How often to redraw the progress line on a terminal.
+	progressTTYInterval = 200 * time.Millisecond
+
+	// How often to log progress when not on a terminal.
+	progressLogInterval = 10 * time.Second
+)
+
+// Reports the progress of copying files.
+type Progress struct {
+	files      int
+	total      int64
+	copied     atomic.Int64
+	filesDone  atomic.Int64
+	start      time.Time
+	tty        bool
+	stop       chan struct{}
+	wg         sync.WaitGroup
+	lastLength int
+}
+
+// Make a progress reporter for copying a number of files totaling a size.
+func newProgress(files int, total int64) *Progress {
+	p := &Progress{
+		files: files,
+		total: total,
+		stop:  make(chan struct{}),
+	}
+
+	// Draw a progress line if log output goes to a terminal.
+	if stat, err := os.Stderr.Stat(); err == nil {
+		p.tty = stat.Mode()&os.ModeCharDevice != 0
+	}
+	return p
+}
+
+// Count bytes copied, used as a writer alongside the destination.
+func (p *Progress) Write(b []byte) (int, error) {
+	p.copied.Add(int64(len(b)))
+	return len(b), nil
+}
+
+// Count a file as done.
+func (p *Progress) Done() {
+	p.filesDone.Add(1)
+}
+
+// Start reporting progress.
+func (p *Progress) Start() {
+	p.start = time.Now()
+	interval := progressLogInterval
+	if p.tty {
+		interval = progressTTYInterval
+	}
+
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				p.report()
+			case <-p.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop reporting progress and log the final result.
+func (p *Progress) Stop() {
+	close(p.stop)
+	p.wg.Wait()
+
+	// Clear the progress line.
+	if p.tty && p.lastLength != 0 {
+		fmt.Fprintf(os.Stderr, "\r%*s\r", p.lastLength, "")
+	}
+	log.Printf("Copied %d of %d files, %s in %s (%s/s)", p.filesDone.Load(), p.files, formatSize(p.copied.Load()), time.Since(p.start).Round(time.Millisecond), formatSize(p.rate()))
+}
+
+// The bytes copied per second.
+func (p *Progress) rate() int64 {
+	elapsed := time.Since(p.start).Seconds()
+	if elapsed <= 0 {
+		return 0
+	}
+	return int64(float64(p.copied.Load()) / elapsed)
+}
+
+// Report the current progress.
+func (p *Progress) report() {
+	copied := p.copied.Load()
+	percent := 100.0
+	if p.total > 0 {
+		percent = float64(copied) / float64(p.total) * 100
+	}
+	line := fmt.Sprintf("Copying %d/%d files, %s of %s (%.0f%%) at %s/s", p.filesDone.Load(), p.files, formatSize(copied), formatSize(p.total), percent, formatSize(p.rate()))
+
+	// On a terminal, redraw the line in place.
+	if p.tty {
+		fmt.Fprintf(os.Stderr, "\r%-*s", p.lastLength, line)
+		p.lastLength = len(line)
+		return
+	}
+	log.Println(line)
+}
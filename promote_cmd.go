@@ -0,0 +1,45 @@
+package main
+
+import (
+	"log"
+)
+
+type PromoteCmd struct {
+	Tag        string `help:"Tag of the release to promote." required:""`
+	Prerelease bool   `help:"Promote a draft to a prerelease instead of a stable release."`
+	BumpDate   bool   `help:"Set the published at date to the current time."`
+}
+
+// Promotes a draft or prerelease to a published release.
+func (a *PromoteCmd) Run() error {
+	return changeReleaseState(a.Tag, false, a.Prerelease, a.BumpDate)
+}
+
+type DemoteCmd struct {
+	Tag        string `help:"Tag of the release to demote." required:""`
+	Prerelease bool   `help:"Demote to a prerelease instead of a draft."`
+}
+
+// Demotes a published release to a draft or prerelease.
+func (a *DemoteCmd) Run() error {
+	return changeReleaseState(a.Tag, !a.Prerelease, a.Prerelease, false)
+}
+
+// Change the draft and prerelease state of a release and update latest to match.
+func changeReleaseState(tag string, draft, prerelease, bumpDate bool) error {
+	err := modifyRelease(tag, func(release *HttpRelease) error {
+		release.Draft = draft
+		release.Prerelease = prerelease
+		if bumpDate {
+			release.PublishedAt = app.now
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Release %s is now draft=%t prerelease=%t", tag, draft, prerelease)
+
+	return nil
+}
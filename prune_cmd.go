@@ -1,114 +1,199 @@
 package main
 
 import (
-	"errors"
 	"fmt"
 	"log"
+	"maps"
 	"os"
 	"path/filepath"
+	"slices"
 	"time"
 )
 
 type PruneCmd struct {
-	MaxAge      time.Duration `help:"Delete releases older than."`
-	MaxReleases int           `help:"Maximum number of releases to keep."`
-	DryRun      bool          `help:"Just log the result without actually pruning."`
+	MaxAge             time.Duration `help:"Keep releases published within this duration."`
+	MaxReleases        int           `help:"Keep this many of the newest releases."`
+	KeepLastStable     int           `help:"Keep this many of the newest stable releases."`
+	KeepLastPrerelease int           `help:"Keep this many of the newest prereleases."`
+	KeepPerMajor       int           `help:"Keep this many of the newest releases of each major version."`
+	KeepPerMinor       int           `help:"Keep this many of the newest releases of each minor version."`
+	KeepPerChannel     int           `help:"Keep this many of the newest releases of each channel."`
+	MaxSize            ByteSize      `help:"Prune the oldest releases until the repo is at most this size, such as 20GiB."`
+	MinKeep            *int          `help:"Always keep at least this many of the newest releases, defaults to 1."`
+	Mode               string        `help:"Keep releases any rule keeps (union) or only releases every rule keeps (intersection), defaults to union."`
+	PolicyFile         string        `help:"YAML file with the prune policy, flags override its values." type:"existingfile"`
+	DryRun             bool          `help:"Just log the result without actually pruning."`
+	Channel            string        `help:"Only prune releases in this channel."`
+
+	policy *PrunePolicy
 }
 
-// Extra help to explain you can't set 2 prune stratages.
+// Extra help to explain how prune rules combine.
 func (a *PruneCmd) Help() string {
-	return "You cannot use both max-age and max-releases, only set one."
+	return "Each rule keeps a set of releases, and releases no rule keeps are pruned. " +
+		"With --mode=intersection, only releases every rule keeps are kept. " +
+		"Pruned releases are moved to the trash, where they can be restored until the trash is emptied. " +
+		"Pinned releases are never pruned and don't count towards any rule. " +
+		"With --max-size, the oldest trash entries, then releases the rules pruned, then the oldest releases which aren't pinned or latest, are deleted until the total asset size fits. " +
+		"The policy file uses the rule names with underscores, such as keep_last, keep_within, and min_keep."
 }
 
 // Verify the options provided to the command.
 func (a *PruneCmd) AfterApply() error {
-	// If both stratages are defined, we don't allow that.
-	if a.MaxAge > time.Duration(0) && a.MaxReleases > 0 {
-		return errors.New("must only provide one prune argument")
+	// Read the policy file, if provided.
+	a.policy = new(PrunePolicy)
+	if a.PolicyFile != "" {
+		policy, err := readPolicyFile(a.PolicyFile)
+		if err != nil {
+			return fmt.Errorf("unable to read policy file: %s", err)
+		}
+		a.policy = policy
+	}
+
+	// Flags override the policy file.
+	override := func(dst *int, src int) {
+		if src != 0 {
+			*dst = src
+		}
 	}
-	// If no stratages are defined, we don't allow that.
-	if a.MaxAge <= time.Duration(0) && a.MaxReleases <= 0 {
-		return errors.New("must provide one prune argument")
+	override(&a.policy.KeepLast, a.MaxReleases)
+	override(&a.policy.KeepLastStable, a.KeepLastStable)
+	override(&a.policy.KeepLastPrerelease, a.KeepLastPrerelease)
+	override(&a.policy.KeepPerMajor, a.KeepPerMajor)
+	override(&a.policy.KeepPerMinor, a.KeepPerMinor)
+	override(&a.policy.KeepPerChannel, a.KeepPerChannel)
+	if a.MaxAge != 0 {
+		a.policy.KeepWithin = a.MaxAge
 	}
-	return nil
+	if a.MaxSize != 0 {
+		a.policy.MaxSize = a.MaxSize
+	}
+	if a.MinKeep != nil {
+		a.policy.MinKeep = a.MinKeep
+	}
+	if a.Mode != "" {
+		a.policy.Mode = a.Mode
+	}
+
+	// Confirm we have a usable policy.
+	err := a.policy.Validate()
+	if err != nil {
+		return err
+	}
+	return validateChannel(a.Channel)
 }
 
-// Adds a release to a repo.
+// Prunes releases from a repo.
 func (a *PruneCmd) Run() error {
+	// Lock the repo so other processes don't modify it while we are.
+	lock, err := lockForWrite(a.DryRun)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
 	// Read existing manifest for repo.
-	manifestFile := filepath.Join(app.flags.Repo, "manifest.yaml")
+	manifestFile := filepath.Join(app.flags.Repo, manifestFileName)
 	manifest, err := readManifestFile(manifestFile)
 	if err != nil {
 		return err
 	}
 
-	// Keep reference of number of pruned releases.
-	releasesPruned := 0
-	n := len(manifest.Releases)
-
-	// If max releases defined and is less than number of releases, look for items to prune.
-	if a.MaxReleases > 0 && n > a.MaxReleases {
-		// Loop starting at max releases.
-		for i := a.MaxReleases; i < n; i++ {
-			// Get the current release.
-			// We want pull from the top of the stack downward to keep newer releases.
-			version := manifest.Releases[n-(i+1)].TagName
-			log.Println("Removing release:", version)
-
-			// If this isn't a dry run, remove the version directory.
-			if !a.DryRun {
-				err = os.RemoveAll(filepath.Join(app.flags.Repo, version))
-				if err != nil {
-					return fmt.Errorf("untable to remove release files: %s", err)
-				}
-			}
+	// If pruning a channel, only consider releases in that channel.
+	releases := manifest.Releases
+	if a.Channel != "" {
+		releases = manifest.ChannelView(a.Channel).Releases
+	}
 
-			// Count the number pruned.
-			releasesPruned++
+	// Pinned releases are never pruned, so the rules only apply to the others.
+	var candidates []*HttpRelease
+	for _, release := range releases {
+		if release.Pinned {
+			log.Println("Keeping pinned release:", release.TagName)
+			continue
 		}
-
-		// Remove releases from the slice.
-		manifest.Releases = manifest.Releases[n-a.MaxReleases:]
+		candidates = append(candidates, release)
 	}
 
-	// If we are pruning based on duration, do so.
-	if a.MaxAge > time.Duration(0) {
-		// Loop through the releases, and find old releases.
-		for i := 0; i < n; i++ {
-			// If n is 1, we removed too many entries and need to stop.
-			if n == 1 {
-				log.Println("The repo has only 1 release remaining, ending the prune here to keep 1 release.")
-				break
-			}
-
-			// Get the current release, and confirm its age.
-			release := manifest.Releases[i]
-			if app.now.Sub(release.PublishedAt) >= a.MaxAge {
-				// This release is too old, so we need to remove it.
-				version := release.TagName
-				log.Println("Removing release:", version)
+	// Decide which releases to keep.
+	kept := a.policy.Keep(candidates, app.now)
 
-				// If this isn't a dry run, remove the version files.
-				if !a.DryRun {
-					err = os.RemoveAll(filepath.Join(app.flags.Repo, version))
-					if err != nil {
-						return fmt.Errorf("untable to remove release files: %s", err)
-					}
-				}
-
-				// Remove the release from the slice.
-				manifest.Releases = append(manifest.Releases[:i], manifest.Releases[i+1:]...)
+	// If the repo is too large, empty the oldest trash, then delete the oldest releases the rules pruned
+	// instead of trashing them, then prune the oldest releases which aren't latest.
+	// The trash takes up space on the volume, so releases pruned for size are deleted rather than trashed.
+	var trashEmptied []*TrashEntry
+	deleted := make(map[*HttpRelease]bool)
+	if a.policy.MaxSize != 0 {
+		latest := make(map[*HttpRelease]bool)
+		latest[latestRelease(manifest)] = true
+		for _, channel := range manifest.Channels() {
+			latest[latestChannelRelease(manifest, channel)] = true
+		}
 
-				// Back up one on the index and number of releases as one release was deleted.
-				i--
-				n--
+		// Releases the rules pruned stay on the volume in the trash, so count with it.
+		var total int64
+		for _, release := range manifest.Releases {
+			total += release.Size()
+		}
+		trash, err := readTrash(app.flags.Repo)
+		if err != nil {
+			return err
+		}
+		for _, entry := range trash {
+			total += entry.Size()
+		}
+		for _, entry := range trash {
+			if total <= int64(a.policy.MaxSize) {
+				break
+			}
+			log.Println("Emptying trash entry:", entry.Name)
+			trashEmptied = append(trashEmptied, entry)
+			total -= entry.Size()
+		}
+		for _, release := range candidates {
+			if total <= int64(a.policy.MaxSize) {
+				break
+			}
+			if _, ok := kept[release]; !ok {
+				deleted[release] = true
+				total -= release.Size()
+			}
+		}
+		maps.Copy(deleted, a.policy.FitSize(candidates, kept, total, func(release *HttpRelease) bool {
+			return latest[release]
+		}))
+	}
 
-				// Count number of releases pruned.
-				releasesPruned++
+	// Find the releases which weren't kept.
+	var prunedReleases, trashedReleases []*HttpRelease
+	var reclaimed, trashed int64
+	pruned := make(map[*HttpRelease]bool)
+	for _, release := range candidates {
+		if reasons, ok := kept[release]; ok {
+			log.Println("Keeping release:", release.TagName, reasons)
+			continue
+		}
+		if deleted[release] {
+			log.Println("Deleting release:", release.TagName)
+			reclaimed += release.Size()
+		} else {
+			log.Println("Removing release:", release.TagName)
+			trashedReleases = append(trashedReleases, release)
+			trashed += release.Size()
+		}
+		prunedReleases = append(prunedReleases, release)
+		pruned[release] = true
+	}
+	releasesPruned := len(prunedReleases)
 
-			}
+	// Remove the pruned releases from the manifest.
+	releases = nil
+	for _, release := range manifest.Releases {
+		if !pruned[release] {
+			releases = append(releases, release)
 		}
 	}
+	manifest.Releases = releases
 
 	// Write the manifest if this isn't a dry run.
 	if !a.DryRun {
@@ -116,10 +201,69 @@ func (a *PruneCmd) Run() error {
 		if err != nil {
 			return err
 		}
+
+		// The latest release may have been pruned.
+		err = updateLatestLinks(app.flags.Repo, manifest)
+		if err != nil {
+			return fmt.Errorf("unable to update latest link: %s", err)
+		}
+
+		// Empty the trash entries needed to fit the maximum size.
+		for _, entry := range trashEmptied {
+			err = os.RemoveAll(entry.Path)
+			if err != nil {
+				return fmt.Errorf("unable to remove trash entry: %s", err)
+			}
+		}
+
+		// Delete releases pruned for size.
+		for _, release := range prunedReleases {
+			if !deleted[release] {
+				continue
+			}
+			err = os.RemoveAll(filepath.Join(app.flags.Repo, release.URL))
+			if err != nil {
+				return fmt.Errorf("unable to remove release files: %s", err)
+			}
+		}
+
+		// Move the rest to the trash so they can be restored.
+		if len(trashedReleases) != 0 {
+			entry, err := moveToTrash(app.flags.Repo, trashedReleases)
+			if err != nil {
+				return fmt.Errorf("unable to move releases to the trash: %s", err)
+			}
+			log.Println("Moved pruned releases to trash entry", entry.Name)
+		}
 	}
 
 	// Provide details on what's been pruned.
 	log.Println("Pruned", releasesPruned, "release from the repo.")
+	if len(trashedReleases) != 0 {
+		log.Println("Trashed releases use", formatSize(trashed), "which is reclaimed once the trash is emptied.")
+	}
+	if a.policy.MaxSize != 0 {
+		for _, entry := range trashEmptied {
+			reclaimed += entry.Size()
+		}
+		log.Println("Reclaimed", formatSize(reclaimed), "from deleted releases and the trash.")
+	}
+
+	// Remove blobs no release references, including those in the trash.
+	// In a dry run the trashed releases aren't in the trash, but would still reference their blobs from it.
+	referenced := manifest
+	if a.DryRun {
+		referenced = &HttpManifest{Releases: slices.Concat(manifest.Releases, trashedReleases)}
+	}
+	blobsRemoved, blobsReclaimed, err := collectBlobs(app.flags.Repo, referenced, a.DryRun)
+	if err != nil {
+		return fmt.Errorf("unable to collect unreferenced blobs: %s", err)
+	}
+	if blobsRemoved != 0 && a.DryRun {
+		log.Println("Would remove", blobsRemoved, "unreferenced blobs, reclaiming", formatSize(blobsReclaimed))
+	} else if blobsRemoved != 0 {
+		log.Println("Removed", blobsRemoved, "unreferenced blobs, reclaiming", formatSize(blobsReclaimed))
+	}
 
 	return nil
 }
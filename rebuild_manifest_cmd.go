@@ -0,0 +1,300 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+type RebuildManifestCmd struct {
+	DryRun bool   `help:"Show the differences from the current manifest without writing it."`
+	Name   string `help:"Project name for releases without goreleaser metadata."`
+}
+
+// Rebuilds the manifest from the release directories in the repo.
+func (a *RebuildManifestCmd) Run() error {
+	// Lock the repo so other processes don't modify it while we are.
+	lock, err := lockForWrite(a.DryRun)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
+	// Read the current manifest, details from it are kept where they still match.
+	manifestFile := filepath.Join(app.flags.Repo, manifestFileName)
+	current, err := readManifestFile(manifestFile)
+	if err != nil {
+		// The backup has the details of all but the last change.
+		backup, berr := readManifestFile(manifestFile + backupFileSuffix)
+		if berr == nil {
+			log.Println("Unable to read the current manifest, rebuilding from its backup:", err)
+			current = backup
+		} else {
+			log.Println("Unable to read the current manifest or its backup, rebuilding from scratch:", err)
+			current = new(HttpManifest)
+		}
+	}
+
+	// Releases in the trash keep their IDs for restoring, and may have details of releases
+	// left in the repo if moving them to the trash failed.
+	trash, err := readTrash(app.flags.Repo)
+	if err != nil {
+		return err
+	}
+	var trashed []*HttpRelease
+	for _, entry := range trash {
+		trashed = append(trashed, entry.Manifest.Releases...)
+	}
+
+	// Index the known releases and assets by URL, preferring the current manifest.
+	currentReleases := make(map[string]*HttpRelease)
+	currentAssets := make(map[string]*HttpAsset)
+	for _, release := range slices.Concat(current.Releases, trashed) {
+		if _, ok := currentReleases[release.URL]; ok {
+			continue
+		}
+		currentReleases[release.URL] = release
+		for _, asset := range release.Assets {
+			currentAssets[asset.URL] = asset
+		}
+	}
+
+	// Scan the release directories.
+	manifest := &HttpManifest{
+		LastReleaseID: current.LastReleaseID,
+		LastAssetID:   current.LastAssetID,
+	}
+	entries, err := os.ReadDir(app.flags.Repo)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() || isRepoFile(entry.Name()) {
+			continue
+		}
+		release, err := a.scanRelease(entry.Name(), currentReleases[entry.Name()], currentAssets)
+		if err != nil {
+			return err
+		}
+		manifest.Releases = append(manifest.Releases, release)
+	}
+	manifest.Sort()
+
+	// IDs already in use must stay, so the counters start above them.
+	for _, release := range slices.Concat(manifest.Releases, trashed) {
+		manifest.LastReleaseID = max(manifest.LastReleaseID, release.ID)
+		for _, asset := range release.Assets {
+			manifest.LastAssetID = max(manifest.LastAssetID, asset.ID)
+		}
+	}
+
+	// Assign IDs to new releases and assets in version order.
+	for _, release := range manifest.Releases {
+		if release.ID == 0 {
+			manifest.LastReleaseID++
+			release.ID = manifest.LastReleaseID
+			release.ReleaseID = release.ID
+		}
+		for _, asset := range release.Assets {
+			if asset.ID == 0 {
+				manifest.LastAssetID++
+				asset.ID = manifest.LastAssetID
+			}
+		}
+	}
+
+	// Show what changed.
+	changes := diffManifests(current, manifest)
+	for _, change := range changes {
+		fmt.Println(change)
+	}
+	if len(changes) == 0 {
+		log.Println("The manifest already matches the repo.")
+	}
+
+	// If this is a dry run, we're done.
+	if a.DryRun {
+		return nil
+	}
+
+	// Write the manifest.
+	err = writeManifestFile(manifestFile, manifest)
+	if err != nil {
+		return err
+	}
+	err = updateLatestLinks(app.flags.Repo, manifest)
+	if err != nil {
+		return fmt.Errorf("unable to update latest link: %s", err)
+	}
+
+	log.Println("Rebuilt manifest with", len(manifest.Releases), "releases for the repo", app.flags.Repo)
+
+	return nil
+}
+
+// Scan a release directory, keeping details from the current release where available.
+func (a *RebuildManifestCmd) scanRelease(dir string, current *HttpRelease, currentAssets map[string]*HttpAsset) (*HttpRelease, error) {
+	release := &HttpRelease{
+		Name:    a.Name,
+		TagName: dir,
+		URL:     dir,
+	}
+
+	// Keep the details from the current manifest.
+	if current != nil {
+		copied := *current
+		release = &copied
+		release.Assets = nil
+	} else {
+		// Use the goreleaser metadata preserved or published with the release.
+		metadata, err := readMetadataFile(filepath.Join(app.flags.Repo, dir, releaseMetadataDir, "metadata.json"))
+		if err != nil {
+			metadata, err = readMetadataFile(filepath.Join(app.flags.Repo, dir, "metadata.json"))
+		}
+		if err == nil {
+			release.Name = metadata.Name
+			release.TagName = metadata.Version
+			release.PublishedAt = metadata.Date
+			release.Tag = metadata.Tag
+			release.PreviousTag = metadata.PreviousTag
+			release.Commit = metadata.Commit
+		} else if stat, serr := os.Stat(filepath.Join(app.flags.Repo, dir)); serr == nil {
+			release.PublishedAt = stat.ModTime()
+		}
+		log.Println("Found release not in the manifest:", release.TagName)
+	}
+
+	// Use the preserved goreleaser artifacts to fill in asset details.
+	root := filepath.Join(app.flags.Repo, dir)
+	preserved := make(map[string]*Artifact)
+	artifacts, _ := readArtifactFile(filepath.Join(root, releaseMetadataDir, "artifacts.json"))
+	for _, artifact := range artifacts {
+		preserved[dir+"/"+artifact.Path] = artifact
+	}
+
+	// Find the assets in the release.
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		// Skip hidden files and directories.
+		if path != root && strings.HasPrefix(d.Name(), ".") {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		// Get the file size.
+		stat, err := d.Info()
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(app.flags.Repo, path)
+		url := filepath.ToSlash(rel)
+
+		// Keep the current asset if it matches the file.
+		currentAsset, ok := currentAssets[url]
+		if ok && currentAsset.Size == int(stat.Size()) {
+			copied := *currentAsset
+			release.Assets = append(release.Assets, &copied)
+			return nil
+		}
+
+		// Make a new asset for the file.
+		checksum, err := fileChecksum(path)
+		if err != nil {
+			return err
+		}
+		asset := &HttpAsset{
+			Name:     d.Name(),
+			Size:     int(stat.Size()),
+			URL:      url,
+			Checksum: checksum,
+		}
+		if currentAsset != nil {
+			asset.ID = currentAsset.ID
+			asset.Type = currentAsset.Type
+		}
+		if artifact, ok := preserved[url]; ok {
+			asset.Name = artifact.Name
+			asset.Type = artifact.Type
+			asset.Goos = artifact.Goos
+			asset.Goarch = artifact.Goarch
+			asset.Goarm = artifact.Goarm
+			asset.Goamd64 = artifact.Goamd64
+		}
+		if asset.Type == "" && strings.HasSuffix(asset.Name, signatureSuffix) {
+			asset.Type = "Signature"
+		}
+		release.Assets = append(release.Assets, asset)
+		return nil
+	})
+	return release, err
+}
+
+// Describe the differences between two manifests.
+func diffManifests(old, new *HttpManifest) []string {
+	var changes []string
+
+	// Index the old releases.
+	oldReleases := make(map[string]*HttpRelease)
+	for _, release := range old.Releases {
+		oldReleases[release.URL] = release
+	}
+	newReleases := make(map[string]bool)
+
+	// Find added and changed releases.
+	for _, release := range new.Releases {
+		newReleases[release.URL] = true
+		oldRelease, ok := oldReleases[release.URL]
+		if !ok {
+			changes = append(changes, fmt.Sprintf("+ release %s (%d assets)", release.TagName, len(release.Assets)))
+			continue
+		}
+
+		// Compare the assets.
+		oldAssets := make(map[string]*HttpAsset)
+		for _, asset := range oldRelease.Assets {
+			oldAssets[asset.URL] = asset
+		}
+		for _, asset := range release.Assets {
+			oldAsset, ok := oldAssets[asset.URL]
+			if !ok {
+				changes = append(changes, fmt.Sprintf("+ asset %s", asset.URL))
+			} else if oldAsset.Size != asset.Size {
+				changes = append(changes, fmt.Sprintf("~ asset %s size %d -> %d", asset.URL, oldAsset.Size, asset.Size))
+			}
+			delete(oldAssets, asset.URL)
+		}
+		for _, asset := range oldRelease.Assets {
+			if _, ok := oldAssets[asset.URL]; ok {
+				changes = append(changes, fmt.Sprintf("- asset %s", asset.URL))
+			}
+		}
+	}
+
+	// Find removed releases.
+	for _, release := range old.Releases {
+		if !newReleases[release.URL] {
+			changes = append(changes, fmt.Sprintf("- release %s", release.TagName))
+		}
+	}
+
+	// Note counter changes.
+	if old.LastReleaseID != new.LastReleaseID {
+		changes = append(changes, fmt.Sprintf("~ last_release_id %d -> %d", old.LastReleaseID, new.LastReleaseID))
+	}
+	if old.LastAssetID != new.LastAssetID {
+		changes = append(changes, fmt.Sprintf("~ last_asset_id %d -> %d", old.LastAssetID, new.LastAssetID))
+	}
+	return changes
+}
@@ -0,0 +1,36 @@
+//go:build linux
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// The FICLONE ioctl, which shares the data of one file with another on filesystems like btrfs and XFS.
+const ficlone = 0x40049409
+
+// Make a copy of a file which shares its data until either is modified.
+func reflinkFile(srcFile, dstFile string) error {
+	// Open the source file.
+	f, err := os.Open(srcFile)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// Make the destination file.
+	d, err := os.OpenFile(dstFile, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+
+	// Clone the data, removing the destination if the filesystem can't.
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, d.Fd(), ficlone, f.Fd())
+	d.Close()
+	if errno != 0 {
+		os.Remove(dstFile)
+		return errno
+	}
+	return nil
+}
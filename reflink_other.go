@@ -0,0 +1,10 @@
+//go:build !linux
+
+package main
+
+import "errors"
+
+// Reflinks are only supported on Linux.
+func reflinkFile(srcFile, dstFile string) error {
+	return errors.New("reflinks are not supported on this platform")
+}
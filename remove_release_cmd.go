@@ -0,0 +1,104 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"path/filepath"
+	"slices"
+)
+
+type RemoveReleaseCmd struct {
+	Tag    string `help:"Tag of the release to remove." required:""`
+	DryRun bool   `help:"Just log the result without actually removing."`
+	Yes    bool   `help:"Don't ask for confirmation." short:"y"`
+}
+
+// Removes a release from a repo.
+func (a *RemoveReleaseCmd) Run() error {
+	manifestFile := filepath.Join(app.flags.Repo, manifestFileName)
+
+	// Confirm the removal before locking the repo, so other processes aren't blocked waiting for an answer.
+	if !a.DryRun && !a.Yes {
+		manifest, err := readManifestFile(manifestFile)
+		if err != nil {
+			return err
+		}
+		if manifest.FindRelease(a.Tag) == -1 {
+			return fmt.Errorf("release %s not found", a.Tag)
+		}
+		if !askForConfirmation("Are you sure you want to remove " + a.Tag + "?") {
+			return errors.New("remove cancelled")
+		}
+	}
+
+	// Lock the repo so other processes don't modify it while we are.
+	lock, err := lockForWrite(a.DryRun)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
+	// Read existing manifest for repo.
+	manifest, err := readManifestFile(manifestFile)
+	if err != nil {
+		return err
+	}
+
+	// Find the release to remove.
+	i := manifest.FindRelease(a.Tag)
+	if i == -1 {
+		return fmt.Errorf("release %s not found", a.Tag)
+	}
+	release := manifest.Releases[i]
+	manifest.Releases = slices.Delete(manifest.Releases, i, i+1)
+
+	// Determine where latest should point once the release is removed.
+	latest := readLatestLink(app.flags.Repo, latestLinkName)
+	newLatest := latest
+	if latest == release.URL {
+		newLatest = ""
+		if r := latestRelease(manifest); r != nil {
+			newLatest = r.URL
+		}
+	}
+
+	log.Println("Removing release:", release.TagName)
+	if newLatest != latest {
+		log.Println("Latest will point to:", newLatest)
+	}
+
+	// If this is a dry run, we're done.
+	if a.DryRun {
+		return nil
+	}
+
+	// Write the manifest first, so the release isn't served while its files are removed.
+	err = writeManifestFile(manifestFile, manifest)
+	if err != nil {
+		return err
+	}
+
+	// Re-point latest links which pointed at the removed release.
+	err = updateLatestLinks(app.flags.Repo, manifest)
+	if err != nil {
+		return fmt.Errorf("unable to update latest link: %s", err)
+	}
+
+	// Move the release files to the trash, so they can be restored.
+	entry, err := moveToTrash(app.flags.Repo, []*HttpRelease{release})
+	if err != nil {
+		return fmt.Errorf("unable to move release to the trash: %s", err)
+	}
+	log.Println("Moved release to trash entry", entry.Name)
+
+	// Remove blobs the release was the last reference to.
+	_, _, err = collectBlobs(app.flags.Repo, manifest, false)
+	if err != nil {
+		return fmt.Errorf("unable to collect unreferenced blobs: %s", err)
+	}
+
+	log.Println("Removed release", release.TagName, "from the repo", app.flags.Repo)
+
+	return nil
+}
@@ -0,0 +1,304 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+const (
+	latestLinkName = "latest"
+	stableChannel  = "stable"
+)
+
+// Channel names are used in file names, so they are kept simple.
+var channelNameRe = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]*$`)
+
+// Confirm a channel name is valid.
+func validateChannel(channel string) error {
+	if channel != "" && !channelNameRe.MatchString(channel) {
+		return errors.New("channel names must be lowercase letters, numbers, dots, underscores and dashes")
+	}
+	return nil
+}
+
+// The name of the manifest file with only a channel's releases.
+func channelManifestFileName(channel string) string {
+	return strings.TrimSuffix(manifestFileName, ".yaml") + "-" + channel + ".yaml"
+}
+
+// Find the channel a channel latest link or manifest belongs to.
+func channelOfRepoFile(name string) (string, bool) {
+	if channel, ok := strings.CutPrefix(name, latestLinkName+"-"); ok && channelNameRe.MatchString(channel) {
+		return channel, true
+	}
+	prefix := strings.TrimSuffix(manifestFileName, ".yaml") + "-"
+	for _, suffix := range []string{".yaml", ".yaml" + signatureSuffix} {
+		if channel, ok := strings.CutPrefix(name, prefix); ok && strings.HasSuffix(channel, suffix) {
+			channel = strings.TrimSuffix(channel, suffix)
+			if channelNameRe.MatchString(channel) {
+				return channel, true
+			}
+		}
+	}
+	return "", false
+}
+
+// Read which release a latest link points to, empty if there is no link.
+func readLatestLink(repo, name string) string {
+	target, err := os.Readlink(filepath.Join(repo, name))
+	if err != nil {
+		return ""
+	}
+	return target
+}
+
+// Point a latest link at a release, replacing any existing link atomically.
+// An empty target removes the link.
+func setLatestLink(repo, name, target string) error {
+	linkPath := filepath.Join(repo, name)
+	if target == "" {
+		err := os.Remove(linkPath)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	// Make the new link beside the old one, then rename it over the old one.
+	tmpPath := filepath.Join(repo, "."+name+".tmp")
+	os.Remove(tmpPath)
+	err := os.Symlink(target, tmpPath)
+	if err != nil {
+		return err
+	}
+	err = os.Rename(tmpPath, linkPath)
+	if err != nil {
+		os.Remove(tmpPath)
+	}
+	return err
+}
+
+// Find the highest stable release, the one latest should point to.
+// Releases with semver prerelease versions, or in a channel other than stable, are not considered stable.
+func latestRelease(manifest *HttpManifest) *HttpRelease {
+	var latest *HttpRelease
+	for _, release := range manifest.Releases {
+		if !isStableRelease(release) {
+			continue
+		}
+		if release.Channel != "" && release.Channel != stableChannel {
+			continue
+		}
+		if latest == nil || compareReleases(release, latest) > 0 {
+			latest = release
+		}
+	}
+	return latest
+}
+
+// Find the highest published release in a channel, prereleases included.
+func latestChannelRelease(manifest *HttpManifest, channel string) *HttpRelease {
+	var latest *HttpRelease
+	for _, release := range manifest.Releases {
+		if release.Draft || release.Channel != channel {
+			continue
+		}
+		if latest == nil || compareReleases(release, latest) > 0 {
+			latest = release
+		}
+	}
+	return latest
+}
+
+// Update a latest link to point at a release, removing it if there is none.
+func updateLatestLink(repo, name string, release *HttpRelease) error {
+	target := ""
+	if release != nil {
+		target = release.URL
+	}
+	if target == readLatestLink(repo, name) {
+		return nil
+	}
+	return setLatestLink(repo, name, target)
+}
+
+// Update the latest links and the channel manifests to match the manifest.
+func updateLatestLinks(repo string, manifest *HttpManifest) error {
+	err := updateLatestLink(repo, latestLinkName, latestRelease(manifest))
+	if err != nil {
+		return err
+	}
+
+	// Update each channel's latest link and manifest.
+	channels := manifest.Channels()
+	for _, channel := range channels {
+		err = updateLatestLink(repo, latestLinkName+"-"+channel, latestChannelRelease(manifest, channel))
+		if err != nil {
+			return err
+		}
+		err = writeManifestView(filepath.Join(repo, channelManifestFileName(channel)), manifest.ChannelView(channel))
+		if err != nil {
+			return err
+		}
+	}
+
+	// Remove the links and manifests of channels which no longer have releases.
+	entries, err := os.ReadDir(repo)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		channel, ok := channelOfRepoFile(entry.Name())
+		if ok && !slices.Contains(channels, channel) {
+			err = os.Remove(filepath.Join(repo, entry.Name()))
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Is this a file the repo keeps at its top level which isn't a release?
+func isRepoFile(name string) bool {
+	// Hidden files are internal, such as the lock and staging directories.
+	if strings.HasPrefix(name, ".") {
+		return true
+	}
+	switch name {
+	case manifestFileName, manifestFileName + backupFileSuffix, manifestFileName + signatureSuffix, latestLinkName, blobsDirName:
+		return true
+	}
+	_, ok := channelOfRepoFile(name)
+	return ok
+}
+
+// Is this a file left at the top level of the repo by an interrupted write or release?
+func isLeftoverFile(name string) bool {
+	return strings.HasPrefix(name, ".staging-") ||
+		(strings.HasPrefix(name, ".manifest-") && strings.HasSuffix(name, ".yaml"))
+}
+
+// Find files and directories in the repo which the manifest doesn't reference.
+// Paths returned are relative to the repo, and an unreferenced directory is returned without its contents.
+func findOrphans(repo string, manifest *HttpManifest) ([]string, error) {
+	// Build the set of referenced files and release directories.
+	referenced := make(map[string]bool)
+	for _, release := range manifest.Releases {
+		referenced[filepath.Clean(release.URL)] = true
+		for _, asset := range release.Assets {
+			path := filepath.Clean(asset.URL)
+			referenced[path] = true
+
+			// Mark the parent directories as referenced.
+			for dir := filepath.Dir(path); dir != "."; dir = filepath.Dir(dir) {
+				referenced[dir] = true
+			}
+		}
+	}
+
+	// Walk the repo looking for anything not referenced.
+	var orphans []string
+	err := filepath.WalkDir(repo, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(repo, path)
+		if err != nil || rel == "." {
+			return err
+		}
+
+		// Skip the files the repo uses at the top level, and the metadata kept with releases.
+		dir, name := filepath.Split(rel)
+		if (dir == "" && isRepoFile(name)) || (referenced[filepath.Clean(dir)] && name == releaseMetadataDir) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		// Record the orphan, skipping the contents of orphaned directories.
+		if !referenced[rel] {
+			orphans = append(orphans, rel)
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+		}
+		return nil
+	})
+	return orphans, err
+}
+
+// Lock the repo so other processes don't modify it while we are.
+// Unless this is a dry run, modifying a signed repo needs the key to keep the signature valid.
+func lockForWrite(dryRun bool) (*RepoLock, error) {
+	lock, err := lockRepo(app.flags.Repo)
+	if err != nil {
+		return nil, err
+	}
+	if !dryRun {
+		err = requireSigningKey(app.flags.Repo)
+		if err != nil {
+			lock.Unlock()
+			return nil, err
+		}
+	}
+	return lock, nil
+}
+
+// Lock the repo and change its manifest, then write it and update the latest links to match.
+// If provided, committed is called once the manifest is written, with the repo still locked.
+func modifyManifest(change func(manifest *HttpManifest) error, committed func() error) error {
+	lock, err := lockForWrite(false)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
+	// Read existing manifest for repo.
+	manifestFile := filepath.Join(app.flags.Repo, manifestFileName)
+	manifest, err := readManifestFile(manifestFile)
+	if err != nil {
+		return err
+	}
+
+	// Make the change.
+	err = change(manifest)
+	if err != nil {
+		return err
+	}
+
+	// Write the manifest.
+	err = writeManifestFile(manifestFile, manifest)
+	if err != nil {
+		return err
+	}
+
+	// The change may affect which release is latest.
+	err = updateLatestLinks(app.flags.Repo, manifest)
+	if err != nil {
+		return fmt.Errorf("unable to update latest link: %s", err)
+	}
+
+	if committed != nil {
+		return committed()
+	}
+	return nil
+}
+
+// Change a release in the manifest, as with modifyManifest.
+func modifyRelease(tag string, change func(release *HttpRelease) error) error {
+	return modifyManifest(func(manifest *HttpManifest) error {
+		i := manifest.FindRelease(tag)
+		if i == -1 {
+			return fmt.Errorf("release %s not found", tag)
+		}
+		return change(manifest.Releases[i])
+	}, nil)
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+)
+
+type RestoreCmd struct {
+	Tag   string `help:"Tag of the release to restore." required:""`
+	Entry string `help:"Trash entry to restore from, defaults to the newest with the release."`
+}
+
+// Restores a release from the trash.
+func (a *RestoreCmd) Run() error {
+	var entry *TrashEntry
+	var release *HttpRelease
+	err := modifyManifest(func(manifest *HttpManifest) error {
+		if manifest.FindRelease(a.Tag) != -1 {
+			return fmt.Errorf("release %s already exists in the repo", a.Tag)
+		}
+
+		// Find the newest trash entry with the release.
+		trash, err := readTrash(app.flags.Repo)
+		if err != nil {
+			return err
+		}
+		i := -1
+		for _, e := range slices.Backward(trash) {
+			if a.Entry != "" && e.Name != a.Entry {
+				continue
+			}
+			if i = e.Manifest.FindRelease(a.Tag); i != -1 {
+				entry = e
+				break
+			}
+		}
+		if entry == nil {
+			return fmt.Errorf("release %s not found in the trash", a.Tag)
+		}
+		release = entry.Manifest.Releases[i]
+
+		// Move the release files back.
+		// If moving them to the trash failed, they were left in the repo and can be used as is.
+		src := filepath.Join(entry.Path, release.URL)
+		dst := filepath.Join(app.flags.Repo, release.URL)
+		if _, err := os.Lstat(src); err == nil {
+			if _, err := os.Lstat(dst); err == nil {
+				return fmt.Errorf("release directory %s already exists", release.URL)
+			}
+			err = os.Rename(src, dst)
+			if err != nil {
+				return fmt.Errorf("unable to restore release files: %s", err)
+			}
+		} else if _, err := os.Lstat(dst); err != nil {
+			return fmt.Errorf("release files for %s are missing from the trash", release.TagName)
+		}
+
+		// Add the release back with its original IDs.
+		manifest.Releases = append(manifest.Releases, release)
+		manifest.Sort()
+		manifest.LastReleaseID = max(manifest.LastReleaseID, release.ID)
+		for _, asset := range release.Assets {
+			manifest.LastAssetID = max(manifest.LastAssetID, asset.ID)
+		}
+		return nil
+	}, func() error {
+		// Remove the release from the trash entry.
+		i := entry.Manifest.FindRelease(release.TagName)
+		entry.Manifest.Releases = slices.Delete(entry.Manifest.Releases, i, i+1)
+		err := entry.save()
+		if err != nil {
+			return fmt.Errorf("unable to update trash entry: %s", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	log.Println("Restored release", release.TagName, "from trash entry", entry.Name)
+
+	return nil
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// A parsed semantic version.
+type Version struct {
+	Major      uint64
+	Minor      uint64
+	Patch      uint64
+	Prerelease []string
+	Build      string
+}
+
+// Parse a semantic version, with or without a leading v.
+func parseVersion(s string) (*Version, error) {
+	v := new(Version)
+	str := strings.TrimPrefix(s, "v")
+
+	// Split off build metadata, which doesn't affect precedence.
+	str, v.Build, _ = strings.Cut(str, "+")
+
+	// Split off the prerelease identifiers.
+	str, pre, hasPre := strings.Cut(str, "-")
+	if hasPre {
+		v.Prerelease = strings.Split(pre, ".")
+		for _, id := range v.Prerelease {
+			if id == "" {
+				return nil, fmt.Errorf("invalid semantic version %s: empty prerelease identifier", s)
+			}
+		}
+	}
+
+	// Parse the version core.
+	parts := strings.Split(str, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("invalid semantic version %s: expected major.minor.patch", s)
+	}
+	nums := []*uint64{&v.Major, &v.Minor, &v.Patch}
+	for i, part := range parts {
+		if part == "" || (len(part) > 1 && part[0] == '0') {
+			return nil, fmt.Errorf("invalid semantic version %s: bad number %q", s, part)
+		}
+		n, err := strconv.ParseUint(part, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid semantic version %s: bad number %q", s, part)
+		}
+		*nums[i] = n
+	}
+
+	return v, nil
+}
+
+// Is this a prerelease version?
+func (v *Version) IsPrerelease() bool {
+	return len(v.Prerelease) != 0
+}
+
+// Compare precedence with another version, returning -1, 0 or 1.
+func (v *Version) Compare(o *Version) int {
+	// Compare the version core.
+	for _, c := range [][2]uint64{{v.Major, o.Major}, {v.Minor, o.Minor}, {v.Patch, o.Patch}} {
+		if c[0] < c[1] {
+			return -1
+		}
+		if c[0] > c[1] {
+			return 1
+		}
+	}
+
+	// A release has higher precedence than its prereleases.
+	if !v.IsPrerelease() || !o.IsPrerelease() {
+		switch {
+		case v.IsPrerelease():
+			return -1
+		case o.IsPrerelease():
+			return 1
+		}
+		return 0
+	}
+
+	// Compare prerelease identifiers in order.
+	for i := 0; i < len(v.Prerelease) && i < len(o.Prerelease); i++ {
+		if c := comparePrereleaseIdentifier(v.Prerelease[i], o.Prerelease[i]); c != 0 {
+			return c
+		}
+	}
+
+	// With equal identifiers, more identifiers has higher precedence.
+	switch {
+	case len(v.Prerelease) < len(o.Prerelease):
+		return -1
+	case len(v.Prerelease) > len(o.Prerelease):
+		return 1
+	}
+	return 0
+}
+
+// Compare prerelease identifiers, numbers compare numerically and below alphanumerics.
+func comparePrereleaseIdentifier(a, b string) int {
+	an, aerr := strconv.ParseUint(a, 10, 64)
+	bn, berr := strconv.ParseUint(b, 10, 64)
+	switch {
+	case aerr == nil && berr == nil:
+		switch {
+		case an < bn:
+			return -1
+		case an > bn:
+			return 1
+		}
+		return 0
+	case aerr == nil:
+		return -1
+	case berr == nil:
+		return 1
+	}
+	return strings.Compare(a, b)
+}
+
+// Compare the order of releases by version.
+// Releases with invalid versions sort before valid ones by publish date.
+func compareReleases(a, b *HttpRelease) int {
+	av, aerr := parseVersion(a.TagName)
+	bv, berr := parseVersion(b.TagName)
+	switch {
+	case aerr == nil && berr == nil:
+		if c := av.Compare(bv); c != 0 {
+			return c
+		}
+	case aerr == nil:
+		return 1
+	case berr == nil:
+		return -1
+	default:
+		if c := a.PublishedAt.Compare(b.PublishedAt); c != 0 {
+			return c
+		}
+	}
+
+	// Fall back to the order they were added.
+	switch {
+	case a.ID < b.ID:
+		return -1
+	case a.ID > b.ID:
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+type ServeCmd struct {
+	Listen      string `help:"Address to listen on." default:"localhost:8080"`
+	TLSCert     string `help:"TLS certificate file to serve HTTPS." type:"existingfile"`
+	TLSKey      string `help:"TLS key file to serve HTTPS." type:"existingfile"`
+	NoAccessLog bool   `help:"Don't log requests."`
+}
+
+// Verify the options provided to the command.
+func (a *ServeCmd) AfterApply() error {
+	if (a.TLSCert == "") != (a.TLSKey == "") {
+		return errors.New("both tls-cert and tls-key must be provided")
+	}
+	return nil
+}
+
+// Serves a repo over HTTP.
+func (a *ServeCmd) Run() error {
+	var handler http.Handler = newRepoHandler(app.flags.Repo)
+	if !a.NoAccessLog {
+		handler = accessLogHandler(handler)
+	}
+	server := &http.Server{
+		Addr:              a.Listen,
+		Handler:           handler,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	// Serve HTTPS if a certificate was provided.
+	if a.TLSCert != "" {
+		log.Println("Serving", app.flags.Repo, "on https://"+a.Listen)
+		return server.ListenAndServeTLS(a.TLSCert, a.TLSKey)
+	}
+	log.Println("Serving", app.flags.Repo, "on http://"+a.Listen)
+	return server.ListenAndServe()
+}
+
+// Content types for files commonly found in a repo which may not be in the system mime types.
+var repoContentTypes = map[string]string{
+	".yaml": "application/yaml",
+	".yml":  "application/yaml",
+	".gz":   "application/gzip",
+	".tgz":  "application/gzip",
+	".zip":  "application/zip",
+	".xz":   "application/x-xz",
+	".sig":  "application/octet-stream",
+	".pem":  "application/x-pem-file",
+	".txt":  "text/plain; charset=utf-8",
+	".json": "application/json",
+}
+
+// Handler serving files from a repo.
+type RepoHandler struct {
+	repo string
+}
+
+// Make a new handler to serve a repo.
+func newRepoHandler(repo string) *RepoHandler {
+	return &RepoHandler{repo: repo}
+}
+
+// Serve a file from the repo.
+func (h *RepoHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Clean the path and split it into parts.
+	urlPath := strings.TrimPrefix(path.Clean("/"+r.URL.Path), "/")
+	parts := strings.Split(urlPath, "/")
+
+	// Hidden files are internal to the repo, such as the lock and staging directories.
+	for _, part := range parts {
+		if strings.HasPrefix(part, ".") {
+			http.NotFound(w, r)
+			return
+		}
+	}
+
+	// Resolve latest links from the manifest rather than the filesystem links.
+	channel, isChannelLatest := channelOfRepoFile(parts[0])
+	isChannelLatest = isChannelLatest && strings.HasPrefix(parts[0], latestLinkName+"-")
+	if parts[0] == latestLinkName || isChannelLatest {
+		manifest, err := readManifestFile(filepath.Join(h.repo, manifestFileName))
+		if err != nil {
+			http.Error(w, "unable to read manifest", http.StatusInternalServerError)
+			return
+		}
+		release := latestRelease(manifest)
+		if isChannelLatest {
+			release = latestChannelRelease(manifest, channel)
+		}
+		if release == nil {
+			http.NotFound(w, r)
+			return
+		}
+		parts[0] = release.URL
+	}
+
+	// Open the file, directories are not served.
+	f, err := os.Open(filepath.Join(h.repo, filepath.Join(parts...)))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer f.Close()
+	stat, err := f.Stat()
+	if err != nil || stat.IsDir() {
+		http.NotFound(w, r)
+		return
+	}
+
+	// Set the content type and cache headers, ServeContent handles the conditional and range requests.
+	ext := strings.ToLower(filepath.Ext(stat.Name()))
+	if contentType, ok := repoContentTypes[ext]; ok {
+		w.Header().Set("Content-Type", contentType)
+	} else if contentType := mime.TypeByExtension(ext); contentType != "" {
+		w.Header().Set("Content-Type", contentType)
+	} else {
+		w.Header().Set("Content-Type", "application/octet-stream")
+	}
+	w.Header().Set("ETag", fmt.Sprintf(`"%x-%x"`, stat.ModTime().UnixNano(), stat.Size()))
+	w.Header().Set("Cache-Control", "no-cache")
+	http.ServeContent(w, r, stat.Name(), stat.ModTime(), f)
+}
+
+// Response writer that records the status and size for access logs.
+type loggingResponseWriter struct {
+	http.ResponseWriter
+	status int
+	size   int64
+}
+
+// Record the status code.
+func (w *loggingResponseWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// Record the bytes written.
+func (w *loggingResponseWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.size += int64(n)
+	return n, err
+}
+
+// Wrap a handler to log each request.
+func accessLogHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		lw := &loggingResponseWriter{ResponseWriter: w}
+		next.ServeHTTP(lw, r)
+		if lw.status == 0 {
+			lw.status = http.StatusOK
+		}
+		log.Printf("%s %s %s %d %d %s %q", r.RemoteAddr, r.Method, r.URL.RequestURI(), lw.status, lw.size, time.Since(start), r.UserAgent())
+	})
+}
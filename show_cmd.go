@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+	"time"
+)
+
+type ShowCmd struct {
+	Tag    string `arg:"" help:"Tag of the release to show."`
+	Output string `help:"Output format." enum:"table,json,yaml" default:"table" short:"o"`
+}
+
+// Shows the details of a release in a repo.
+func (a *ShowCmd) Run() error {
+	// Read existing manifest for repo.
+	manifest, err := readManifestFile(filepath.Join(app.flags.Repo, manifestFileName))
+	if err != nil {
+		return err
+	}
+
+	// Find the release requested.
+	i := manifest.FindRelease(a.Tag)
+	if i == -1 {
+		return fmt.Errorf("release %s not found", a.Tag)
+	}
+	release := manifest.Releases[i]
+
+	// Structured output is for scripts.
+	if a.Output != "table" {
+		return writeOutput(os.Stdout, a.Output, release)
+	}
+
+	// Print the release details.
+	fmt.Println("Tag:", release.TagName)
+	fmt.Println("Name:", release.Name)
+	fmt.Println("ID:", release.ID)
+	fmt.Println("Git Tag:", release.Tag)
+	fmt.Println("Previous Tag:", release.PreviousTag)
+	fmt.Println("Commit:", release.Commit)
+	fmt.Println("Draft:", release.Draft)
+	fmt.Println("Prerelease:", release.Prerelease)
+	fmt.Println("Channel:", release.Channel)
+	fmt.Println("Pinned:", release.Pinned)
+	fmt.Println("Published:", release.PublishedAt.Format(time.RFC3339))
+	fmt.Println("Latest:", release.URL == readLatestLink(app.flags.Repo, latestLinkName))
+	fmt.Println()
+	fmt.Println("Notes:")
+	fmt.Println(release.ReleaseNotes)
+	fmt.Println()
+
+	// Print a table of the assets.
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tNAME\tTYPE\tPLATFORM\tSIZE\tURL")
+	for _, asset := range release.Assets {
+		platform := ""
+		if asset.Goos != "" {
+			platform = asset.Goos + "/" + asset.Goarch + asset.Goarm
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\n",
+			asset.ID,
+			asset.Name,
+			asset.Type,
+			platform,
+			formatSize(int64(asset.Size)),
+			asset.URL,
+		)
+	}
+	return w.Flush()
+}
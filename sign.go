@@ -0,0 +1,160 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Suffix go-selfupdate looks for when validating a file with a signature.
+const signatureSuffix = ".sig"
+
+// Read a PEM encoded ed25519 or ECDSA P-256 private key.
+func readSigningKey(keyFile string) (crypto.Signer, error) {
+	data, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	// Decode the PEM block.
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data found in %s", keyFile)
+	}
+
+	// OpenSSL writes EC keys in SEC 1 form by default, otherwise expect PKCS #8.
+	var key any
+	if block.Type == "EC PRIVATE KEY" {
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	} else {
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse signing key: %s", err)
+	}
+
+	// Confirm this is a supported key.
+	switch k := key.(type) {
+	case ed25519.PrivateKey:
+		return k, nil
+	case *ecdsa.PrivateKey:
+		if k.Curve != elliptic.P256() {
+			return nil, errors.New("only P-256 ECDSA signing keys are supported")
+		}
+		return k, nil
+	}
+	return nil, errors.New("signing key must be ed25519 or ECDSA P-256")
+}
+
+// Sign data in the form go-selfupdate validators expect.
+// ECDSA signs the SHA-256 digest with an ASN.1 signature, ed25519 signs the data itself.
+func signData(signer crypto.Signer, data []byte) ([]byte, error) {
+	if _, ok := signer.Public().(ed25519.PublicKey); ok {
+		return signer.Sign(rand.Reader, data, crypto.Hash(0))
+	}
+	digest := sha256.Sum256(data)
+	return signer.Sign(rand.Reader, digest[:], crypto.SHA256)
+}
+
+// Refuse to modify a signed repo without the signing key, as the signature would go stale.
+func requireSigningKey(repo string) error {
+	if app.signer != nil {
+		return nil
+	}
+	if _, err := os.Stat(filepath.Join(repo, manifestFileName+signatureSuffix)); err == nil {
+		return errors.New("the repo manifest is signed, provide --signing-key to modify it")
+	}
+	return nil
+}
+
+// Read a PEM encoded ed25519 or ECDSA P-256 public key.
+func readPublicKey(keyFile string) (crypto.PublicKey, error) {
+	data, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data found in %s", keyFile)
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse public key: %s", err)
+	}
+	switch k := key.(type) {
+	case ed25519.PublicKey:
+		return k, nil
+	case *ecdsa.PublicKey:
+		if k.Curve == elliptic.P256() {
+			return k, nil
+		}
+	}
+	return nil, errors.New("public key must be ed25519 or ECDSA P-256")
+}
+
+// Verify a signature made by signData.
+func verifySignature(pub crypto.PublicKey, data, sig []byte) bool {
+	switch k := pub.(type) {
+	case ed25519.PublicKey:
+		return ed25519.Verify(k, data, sig)
+	case *ecdsa.PublicKey:
+		digest := sha256.Sum256(data)
+		return ecdsa.VerifyASN1(k, digest[:], sig)
+	}
+	return false
+}
+
+// Sign a file, writing the signature beside it.
+func signFile(signer crypto.Signer, path string) error {
+	var sig []byte
+	if _, ok := signer.Public().(ed25519.PublicKey); ok {
+		// Ed25519 needs the whole message to sign.
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		sig, err = signData(signer, data)
+		if err != nil {
+			return err
+		}
+	} else {
+		// Hash the file as a stream so large files aren't read into memory.
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		h := sha256.New()
+		_, err = io.Copy(h, f)
+		f.Close()
+		if err != nil {
+			return err
+		}
+		sig, err = signer.Sign(rand.Reader, h.Sum(nil), crypto.SHA256)
+		if err != nil {
+			return err
+		}
+	}
+	return writeFileAtomic(path+signatureSuffix, sig, 0644)
+}
+
+// Generate a new signing key pair.
+func generateSigningKey(keyType string) (crypto.Signer, error) {
+	switch keyType {
+	case "ed25519":
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		return key, err
+	case "ecdsa":
+		return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	}
+	return nil, fmt.Errorf("unknown key type: %s", keyType)
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// The hidden directory in the repo removed releases are kept in until the trash is emptied.
+const trashDirName = ".trash"
+
+// The format of trash entry names, which record when the releases were removed.
+const trashTimeFormat = "20060102T150405Z"
+
+// A set of releases removed together, with their manifest entries.
+type TrashEntry struct {
+	Name     string
+	Path     string
+	Time     time.Time
+	Manifest *HttpManifest
+}
+
+// Move releases into a new trash entry with their manifest entries.
+func moveToTrash(repo string, releases []*HttpRelease) (*TrashEntry, error) {
+	trashDir := filepath.Join(repo, trashDirName)
+	err := os.MkdirAll(trashDir, 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	// Make a new entry named for the time of removal.
+	entry := &TrashEntry{
+		Name:     app.now.UTC().Format(trashTimeFormat),
+		Time:     app.now,
+		Manifest: &HttpManifest{Releases: releases},
+	}
+	name := entry.Name
+	for i := 1; ; i++ {
+		entry.Path = filepath.Join(trashDir, entry.Name)
+		err = os.Mkdir(entry.Path, 0755)
+		if !os.IsExist(err) {
+			break
+		}
+		entry.Name = fmt.Sprintf("%s-%d", name, i)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Save the manifest entries first, so the entry can always be read and restored.
+	err = entry.save()
+	if err != nil {
+		return nil, err
+	}
+
+	// Move the release files into the entry.
+	for _, release := range releases {
+		dst := filepath.Join(entry.Path, release.URL)
+		err = os.MkdirAll(filepath.Dir(dst), 0755)
+		if err != nil {
+			return nil, err
+		}
+		err = os.Rename(filepath.Join(repo, release.URL), dst)
+		if os.IsNotExist(err) {
+			log.Println("Release files are missing for:", release.TagName)
+		} else if err != nil {
+			return nil, err
+		}
+	}
+
+	return entry, nil
+}
+
+// Save the entry manifest, removing the entry once it's empty.
+func (e *TrashEntry) save() error {
+	if len(e.Manifest.Releases) == 0 {
+		return os.RemoveAll(e.Path)
+	}
+	return writeManifestView(filepath.Join(e.Path, manifestFileName), e.Manifest)
+}
+
+// The total size of the assets in the entry.
+func (e *TrashEntry) Size() int64 {
+	var size int64
+	for _, release := range e.Manifest.Releases {
+		size += release.Size()
+	}
+	return size
+}
+
+// Read the trash entries in a repo, oldest first.
+func readTrash(repo string) ([]*TrashEntry, error) {
+	trashDir := filepath.Join(repo, trashDirName)
+	dirs, err := os.ReadDir(trashDir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var entries []*TrashEntry
+	for _, dir := range dirs {
+		// Skip anything which isn't an entry.
+		name := dir.Name()
+		if !dir.IsDir() || len(name) < len(trashTimeFormat) {
+			continue
+		}
+		trashed, err := time.Parse(trashTimeFormat, name[:len(trashTimeFormat)])
+		if err != nil {
+			continue
+		}
+
+		// Read the manifest entries.
+		path := filepath.Join(trashDir, name)
+		manifest, err := readManifestFile(filepath.Join(path, manifestFileName))
+		if err != nil {
+			log.Printf("Skipping trash entry %s as it can't be read: %s", name, err)
+			continue
+		}
+		entries = append(entries, &TrashEntry{
+			Name:     name,
+			Path:     path,
+			Time:     trashed,
+			Manifest: manifest,
+		})
+	}
+	return entries, nil
+}
@@ -2,10 +2,22 @@ package main
 
 import (
 	"bufio"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/alecthomas/kong"
+	"gopkg.in/yaml.v3"
 )
 
 // Helper for CLI to ask for confirmation.
@@ -17,8 +29,11 @@ func askForConfirmation(message string) bool {
 	for {
 		fmt.Printf("%s [y/n]: ", message)
 
-		// Get next line.
-		scanner.Scan()
+		// Get next line, with no more input being no answer.
+		if !scanner.Scan() {
+			fmt.Println()
+			return false
+		}
 		resp := strings.ToLower(strings.TrimSpace(scanner.Text()))
 
 		// Check if yes or no.
@@ -33,8 +48,8 @@ func askForConfirmation(message string) bool {
 	}
 }
 
-// Helper for copying files.
-func copyFile(srcFile, dstFile string) (err error) {
+// Helper for copying files, the data copied is also written to any writers provided, such as hashes.
+func copyFile(srcFile, dstFile string, writers ...io.Writer) (err error) {
 	// Open the source file.
 	f, err := os.Open(srcFile)
 	if err != nil {
@@ -50,7 +65,11 @@ func copyFile(srcFile, dstFile string) (err error) {
 	defer d.Close()
 
 	// Copy the data to the new file.
-	_, err = io.Copy(d, f)
+	w := io.Writer(d)
+	if len(writers) != 0 {
+		w = io.MultiWriter(append([]io.Writer{d}, writers...)...)
+	}
+	_, err = io.Copy(w, f)
 	if err != nil {
 		return
 	}
@@ -59,3 +78,230 @@ func copyFile(srcFile, dstFile string) (err error) {
 	err = d.Sync()
 	return
 }
+
+// Helper to sync a directory, ensuring renames and new entries are persisted.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	// Some platforms don't support syncing directories, which is fine to ignore.
+	err = d.Sync()
+	if err != nil && !errors.Is(err, os.ErrInvalid) && !errors.Is(err, syscall.EINVAL) {
+		return err
+	}
+	return nil
+}
+
+// Helper to format a byte count for people to read.
+func formatSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
+
+// Helper to get the size of a file, or the total size of the files in a directory.
+func pathSize(path string) (int64, error) {
+	var size int64
+	err := filepath.WalkDir(path, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		size += info.Size()
+		return nil
+	})
+	return size, err
+}
+
+// A size in bytes, which can be given with units such as 20GiB or 500MB.
+type ByteSize int64
+
+// The multiplier for each size unit, single letters are binary units.
+var byteSizeUnits = map[string]int64{
+	"": 1, "b": 1,
+	"k": 1 << 10, "kib": 1 << 10, "kb": 1e3,
+	"m": 1 << 20, "mib": 1 << 20, "mb": 1e6,
+	"g": 1 << 30, "gib": 1 << 30, "gb": 1e9,
+	"t": 1 << 40, "tib": 1 << 40, "tb": 1e12,
+	"p": 1 << 50, "pib": 1 << 50, "pb": 1e15,
+}
+
+// Parse a size with an optional unit.
+func parseByteSize(s string) (ByteSize, error) {
+	s = strings.TrimSpace(s)
+	number, unit := s, ""
+	if i := strings.IndexFunc(s, func(r rune) bool { return (r < '0' || r > '9') && r != '.' }); i != -1 {
+		number, unit = s[:i], strings.TrimSpace(s[i:])
+	}
+	value, err := strconv.ParseFloat(number, 64)
+	multiplier, ok := byteSizeUnits[strings.ToLower(unit)]
+	if err != nil || !ok {
+		return 0, fmt.Errorf("invalid size: %s", s)
+	}
+	return ByteSize(value * float64(multiplier)), nil
+}
+
+// Decode a size from a flag.
+func (b *ByteSize) Decode(ctx *kong.DecodeContext) error {
+	var value string
+	err := ctx.Scan.PopValueInto("size", &value)
+	if err != nil {
+		return err
+	}
+	*b, err = parseByteSize(value)
+	return err
+}
+
+// Decode a size from a YAML file.
+func (b *ByteSize) UnmarshalYAML(node *yaml.Node) error {
+	var err error
+	*b, err = parseByteSize(node.Value)
+	return err
+}
+
+// Helper to write structured output in JSON or YAML.
+func writeOutput(w io.Writer, format string, v any) error {
+	switch format {
+	case "json":
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "    ")
+		return encoder.Encode(v)
+	case "yaml":
+		encoder := yaml.NewEncoder(w)
+		defer encoder.Close()
+		return encoder.Encode(v)
+	}
+	return fmt.Errorf("unknown output format: %s", format)
+}
+
+// Helper to write a file by writing a temp file and renaming it into place.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+"-*")
+	if err != nil {
+		return err
+	}
+	tmpFile := f.Name()
+
+	// Write the data and ensure it is on disk.
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if err == nil {
+		err = f.Chmod(perm)
+	}
+	f.Close()
+	if err == nil {
+		err = os.Rename(tmpFile, path)
+	}
+	if err != nil {
+		os.Remove(tmpFile)
+	}
+	return err
+}
+
+// Helper to run jobs with a limited number of workers, stopping at the first error.
+func runJobs(n, workers int, fn func(i int) error) error {
+	var wg sync.WaitGroup
+	var failed atomic.Bool
+	errs := make([]error, n)
+	jobs := make(chan int)
+
+	// Start the workers.
+	for w := 0; w < min(workers, n); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				// Skip the remaining jobs once one fails.
+				if failed.Load() {
+					continue
+				}
+				errs[i] = fn(i)
+				if errs[i] != nil {
+					failed.Store(true)
+				}
+			}
+		}()
+	}
+
+	// Queue the jobs and wait for them to finish.
+	for i := 0; i < n; i++ {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	// Return the first error in job order.
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Place a file using the fastest method the link mode allows, falling back to a copy.
+// The data placed is written to any writers provided, reading it back if it wasn't copied.
+func placeFile(srcFile, dstFile, linkMode string, writers ...io.Writer) error {
+	// Get the source file details to preserve.
+	stat, err := os.Stat(srcFile)
+	if err != nil {
+		return err
+	}
+
+	// Try the fast paths the link mode allows.
+	placed := false
+	switch linkMode {
+	case "reflink":
+		placed = reflinkFile(srcFile, dstFile) == nil
+	case "hardlink":
+		placed = os.Link(srcFile, dstFile) == nil
+	case "move":
+		// Moves are placed as hard links, the caller removes the source once the move is committed.
+		placed = os.Link(srcFile, dstFile) == nil
+	case "auto":
+		placed = reflinkFile(srcFile, dstFile) == nil || os.Link(srcFile, dstFile) == nil
+	}
+
+	// The file was placed without copying, read it back for the writers.
+	if placed {
+		if len(writers) != 0 {
+			f, err := os.Open(dstFile)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			_, err = io.Copy(io.MultiWriter(writers...), f)
+			if err != nil {
+				return err
+			}
+		}
+	} else {
+		// Copy the file, such as when the fast paths can't cross devices.
+		err = copyFile(srcFile, dstFile, writers...)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Preserve the file mode and modification time.
+	err = os.Chmod(dstFile, stat.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	return os.Chtimes(dstFile, time.Time{}, stat.ModTime())
+}
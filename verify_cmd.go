@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bytes"
+	"crypto"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"gopkg.in/yaml.v3"
+)
+
+type VerifyCmd struct {
+	SkipChecksums bool   `help:"Only check file sizes, skip hashing the assets."`
+	PublicKey     string `help:"Public key to check the manifest signatures with, the signing key is used if provided." type:"existingfile"`
+}
+
+// Extra help to explain what is verified.
+func (a *VerifyCmd) Help() string {
+	return "Checks the assets, IDs, latest links and channel manifests match the manifest. " +
+		"Manifest signatures are checked when a public or signing key is provided. " +
+		"Asset signatures aren't checked, as goreleaser may sign assets with other tools."
+}
+
+// Verifies the repo matches its manifest.
+func (a *VerifyCmd) Run() error {
+	// Read existing manifest for repo.
+	manifest, err := readManifestFile(filepath.Join(app.flags.Repo, manifestFileName))
+	if err != nil {
+		return err
+	}
+
+	// Keep count of the problems found.
+	problems := 0
+	report := func(format string, v ...any) {
+		log.Printf(format, v...)
+		problems++
+	}
+
+	// Check the release and asset IDs.
+	releaseIDs := make(map[int64]string)
+	assetIDs := make(map[int64]string)
+	tags := make(map[string]bool)
+	for _, release := range manifest.Releases {
+		if tags[release.TagName] {
+			report("Release %s is in the manifest more than once.", release.TagName)
+		}
+		tags[release.TagName] = true
+		if other, ok := releaseIDs[release.ID]; ok {
+			report("Release %s has the same ID %d as release %s.", release.TagName, release.ID, other)
+		}
+		releaseIDs[release.ID] = release.TagName
+		if release.ID != release.ReleaseID {
+			report("Release %s has ID %d but release ID %d.", release.TagName, release.ID, release.ReleaseID)
+		}
+		if release.ID > manifest.LastReleaseID {
+			report("Release %s has ID %d which is above the last release ID %d.", release.TagName, release.ID, manifest.LastReleaseID)
+		}
+
+		for _, asset := range release.Assets {
+			if other, ok := assetIDs[asset.ID]; ok {
+				report("Asset %s has the same ID %d as asset %s.", asset.URL, asset.ID, other)
+			}
+			assetIDs[asset.ID] = asset.URL
+			if asset.ID > manifest.LastAssetID {
+				report("Asset %s has ID %d which is above the last asset ID %d.", asset.URL, asset.ID, manifest.LastAssetID)
+			}
+
+			// Check the asset file matches.
+			path := filepath.Join(app.flags.Repo, asset.URL)
+			stat, serr := os.Stat(path)
+			if serr != nil {
+				report("Asset %s is missing: %s", asset.URL, serr)
+				continue
+			}
+			if stat.Size() != int64(asset.Size) {
+				report("Asset %s is %d bytes but the manifest has %d bytes.", asset.URL, stat.Size(), asset.Size)
+				continue
+			}
+			if !a.SkipChecksums && asset.Checksum != "" {
+				if cerr := verifyFileChecksum(path, asset.Checksum); cerr != nil {
+					report("Asset %s failed verification: %s", asset.URL, cerr)
+				}
+			}
+		}
+	}
+
+	// Check for files not in the manifest.
+	orphans, err := findOrphans(app.flags.Repo, manifest)
+	if err != nil {
+		return err
+	}
+	for _, orphan := range orphans {
+		report("%s is not referenced by the manifest.", orphan)
+	}
+
+	// Check the latest link points where it should.
+	latest := readLatestLink(app.flags.Repo, latestLinkName)
+	expected := ""
+	if release := latestRelease(manifest); release != nil {
+		expected = release.URL
+	}
+	if latest != "" {
+		if _, serr := os.Stat(filepath.Join(app.flags.Repo, latestLinkName)); serr != nil {
+			report("The latest link to %s is broken.", latest)
+		}
+	}
+	if latest != expected {
+		report("The latest link points to %q but should point to %q.", latest, expected)
+	}
+
+	// Check each channel's latest link and manifest match the manifest.
+	channels := manifest.Channels()
+	for _, channel := range channels {
+		linkName := latestLinkName + "-" + channel
+		latest := readLatestLink(app.flags.Repo, linkName)
+		expected := ""
+		if release := latestChannelRelease(manifest, channel); release != nil {
+			expected = release.URL
+		}
+		if latest != expected {
+			report("The %s link points to %q but should point to %q.", linkName, latest, expected)
+		}
+
+		// Compare the channel manifest as it would be written.
+		channelFile := channelManifestFileName(channel)
+		view, verr := readManifestFile(filepath.Join(app.flags.Repo, channelFile))
+		if verr != nil {
+			report("The %s channel manifest can't be read: %s", channel, verr)
+			continue
+		}
+		got, _ := yaml.Marshal(view)
+		want, _ := yaml.Marshal(manifest.ChannelView(channel))
+		if !bytes.Equal(got, want) {
+			report("The %s channel manifest doesn't match the manifest.", channel)
+		}
+	}
+
+	// Check for links and channel manifests of channels which no longer exist.
+	entries, err := os.ReadDir(app.flags.Repo)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if channel, ok := channelOfRepoFile(entry.Name()); ok && !slices.Contains(channels, channel) {
+			report("%s is for the %s channel which has no releases.", entry.Name(), channel)
+		}
+	}
+
+	// Check the manifest signatures, if we have a key to check them with.
+	var pub crypto.PublicKey
+	if a.PublicKey != "" {
+		pub, err = readPublicKey(a.PublicKey)
+		if err != nil {
+			return err
+		}
+	} else if app.signer != nil {
+		pub = app.signer.Public()
+	}
+	manifestFiles := []string{manifestFileName}
+	for _, channel := range channels {
+		manifestFiles = append(manifestFiles, channelManifestFileName(channel))
+	}
+	for _, name := range manifestFiles {
+		path := filepath.Join(app.flags.Repo, name)
+		sig, serr := os.ReadFile(path + signatureSuffix)
+		if pub == nil {
+			if serr == nil && name == manifestFileName {
+				log.Println("The manifest is signed, provide --public-key to check the signatures.")
+			}
+			continue
+		}
+		if serr != nil {
+			report("%s isn't signed: %s", name, serr)
+			continue
+		}
+		data, derr := os.ReadFile(path)
+		if derr != nil {
+			report("%s can't be read: %s", name, derr)
+			continue
+		}
+		if !verifySignature(pub, data, sig) {
+			report("The signature of %s isn't valid.", name)
+		}
+	}
+
+	// Fail if any problems were found.
+	if problems != 0 {
+		return fmt.Errorf("found %d problems in the repo", problems)
+	}
+	log.Println("The repo", app.flags.Repo, "matches its manifest.")
+
+	return nil
+}